@@ -2,28 +2,54 @@ package database
 
 import (
 	"database/sql"
+	"errors"
+	"strings"
 	"time"
 
 	"github.com/jmoiron/sqlx"
 )
 
-// Extracted query used to query articles along with their subscriptions
-const articleJoinQuery = `SELECT 
-	a.*,
-	s.id AS "sub.id", s.type as "sub.type", s.url as "sub.url", s.title as "sub.title", s.description as "sub.description", s.thumbnail as "sub.thumbnail"
-FROM articles a INNER JOIN subscriptions s ON s.id = a.subscription_id`
+// Columns and tables of the query used to query articles of a user along with their subscriptions and the state of the articles.
+// They are split, so that other queries can add their own columns and tables to them.
+// The tables take the user id as the first argument, and only include the articles from the feeds the user is subscribed to.
+const (
+	articleJoinColumns = `a.*,
+	ua.read_at, IFNULL(ua.seen, FALSE) AS seen, IFNULL(ua.readlater, FALSE) AS readlater, ua.created_readlater,
+	IFNULL(ua.starred, FALSE) AS starred, ua.starred_at,
+	s.id AS "sub.id", s.type as "sub.type", s.url as "sub.url",
+	IFNULL(us.title, s.title) as "sub.title", IFNULL(us.description, s.description) as "sub.description", IFNULL(us.thumbnail, s.thumbnail) as "sub.thumbnail",
+	s.link as "sub.link", us.folder_id as "sub.folder_id"`
+	articleJoinTables = `articles a INNER JOIN subscriptions s ON s.id = a.subscription_id
+	INNER JOIN user_subscriptions us ON us.subscription_id = s.id AND us.user_id = ?
+	LEFT JOIN user_articles ua ON ua.article_id = a.id AND ua.user_id = us.user_id`
+)
+
+// Extracted query used to query articles of a user along with their subscriptions
+const articleJoinQuery = "SELECT " + articleJoinColumns + " FROM " + articleJoinTables
 
 type Article struct {
-	ID               int64          `db:"id"`
-	SubscriptionId   int64          `db:"subscription_id"`
-	New              bool           `db:"new"`
-	Url              string         `db:"url"`
-	Title            string         `db:"title"`
-	Description      sql.NullString `db:"description"`
-	Thumbnail        sql.NullString `db:"thumbnail"`
-	Created          sql.NullString `db:"created"`
+	ID             int64          `db:"id"`
+	SubscriptionId int64          `db:"subscription_id"`
+	Url            string         `db:"url"`
+	Title          string         `db:"title"`
+	Description    sql.NullString `db:"description"`
+	Thumbnail      sql.NullString `db:"thumbnail"`
+	Created        sql.NullString `db:"created"`
+	// Identity of the article within its subscription
+	Guid string `db:"guid"`
+	// When the article was last changed by the publisher
+	UpdatedAt sql.NullString `db:"updated_at"`
+
+	// State of the article for a user, only set when queried for a user
 	ReadLater        bool           `db:"readlater"`
 	CreatedReadLater sql.NullString `db:"created_readlater"`
+	// When the article was read, null if it is unread
+	ReadAt sql.NullString `db:"read_at"`
+	// Whether the article was shown to the user. Read articles are always seen.
+	Seen bool `db:"seen"`
+	// Starred articles are kept permanently, unlike the read later list
+	Starred   bool           `db:"starred"`
+	StarredAt sql.NullString `db:"starred_at"`
 }
 
 type ArticleWithSubscription struct {
@@ -70,23 +96,6 @@ func (r ArticleRepository) Find(id int64) (*Article, error) {
 	return a, nil
 }
 
-func (r ArticleRepository) Unread() (out []ArticleWithSubscription, err error) {
-	res, err := r.db.Queryx(articleJoinQuery + " WHERE new = TRUE")
-	if err != nil {
-		return nil, err
-	}
-
-	for res.Next() {
-		var aws ArticleWithSubscription
-		if err := res.StructScan(&aws); err != nil {
-			return nil, err
-		}
-		out = append(out, aws)
-	}
-
-	return
-}
-
 func (r ArticleRepository) Exists(url string) (exists bool, err error) {
 	res, err := r.db.Query(`SELECT EXISTS(
 			SELECT 1 FROM articles WHERE articles.url = ?
@@ -104,60 +113,134 @@ func (r ArticleRepository) Exists(url string) (exists bool, err error) {
 	return
 }
 
-// ArticlesInSubscription fetches all the articles that belong to the subscription with the specified id.
-func (r ArticleRepository) ArticlesInSubscription(id int64) ([]Article, error) {
-	rows, err := r.db.Queryx(`SELECT *
-		FROM articles
-		WHERE articles.subscription_id = ?
-		ORDER BY articles.created DESC`,
-		id,
+// RecentDates returns the creation dates of the newest n articles of the subscription, newest first.
+func (r ArticleRepository) RecentDates(subscriptionId int64, n int) ([]time.Time, error) {
+	rows, err := r.db.Query(
+		"SELECT created FROM articles WHERE subscription_id = ? ORDER BY created DESC, id DESC LIMIT ?",
+		subscriptionId, n,
 	)
 	if err != nil {
 		return nil, err
 	}
+	defer rows.Close()
 
-	ais := []Article{}
+	dates := []time.Time{}
 	for rows.Next() {
-		a := Article{}
-		if err := rows.StructScan(&a); err != nil {
+		var created string
+		if err := rows.Scan(&created); err != nil {
 			return nil, err
 		}
-		ais = append(ais, a)
+
+		// Skip dates that were stored in some other format
+		if t, err := time.Parse(time.DateTime, created); err == nil {
+			dates = append(dates, t)
+		}
 	}
 
-	return ais, nil
+	return dates, rows.Err()
 }
 
-// InReadLater returns all articles flagged as read later
-func (r ArticleRepository) InReadLater() ([]ArticleWithSubscription, error) {
-	rows, err := r.db.Queryx(articleJoinQuery + " WHERE readlater = TRUE")
-	if err != nil {
+// FindForUser finds the article along with its subscription and its state for the user.
+// sql.ErrNoRows is returned if the user isn't subscribed to the feed of the article.
+func (r ArticleRepository) FindForUser(userId, id int64) (*ArticleWithSubscription, error) {
+	row := r.db.QueryRowx(articleJoinQuery+" WHERE a.id = ?", userId, id)
+
+	a := &ArticleWithSubscription{}
+	if err := row.StructScan(a); err != nil {
 		return nil, err
 	}
 
-	rl := []ArticleWithSubscription{}
+	return a, nil
+}
+
+// list fetches one page of the articles of the user matching the condition, newest first.
+// A cursor pointing at the last article is returned, if there are more articles after the page.
+func (r ArticleRepository) list(userId int64, cond string, args []any, p Page) ([]ArticleWithSubscription, *Cursor, error) {
+	q := articleJoinQuery + " WHERE " + cond
+	args = append([]any{userId}, args...)
+	if p.After != nil {
+		q += " AND (a.created < ? OR (a.created = ? AND a.id < ?))"
+		args = append(args, p.After.Created, p.After.Created, p.After.ID)
+	}
+	// Fetch one more article, to know if there is a next page
+	q += " ORDER BY a.created DESC, a.id DESC LIMIT ?"
+	args = append(args, p.Limit+1)
+
+	rows, err := r.db.Queryx(q, args...)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer rows.Close()
+
+	out := []ArticleWithSubscription{}
 	for rows.Next() {
 		a := ArticleWithSubscription{}
 		if err := rows.StructScan(&a); err != nil {
-			return nil, err
+			return nil, nil, err
 		}
-		rl = append(rl, a)
+		out = append(out, a)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, nil, err
+	}
+
+	if len(out) <= p.Limit {
+		return out, nil, nil
+	}
+
+	out = out[:p.Limit]
+	last := out[len(out)-1]
+	return out, &Cursor{Created: last.Created.String, ID: last.ID}, nil
+}
+
+// UnreadFilter narrows the unread articles down. Zero values mean no filtering.
+type UnreadFilter struct {
+	// Only articles from the subscriptions in this folder
+	FolderId int64
+	// Only articles that weren't shown to the user yet
+	Unseen bool
+}
+
+// Unread returns a page of articles the user hasn't read.
+func (r ArticleRepository) Unread(userId int64, f UnreadFilter, p Page) ([]ArticleWithSubscription, *Cursor, error) {
+	cond := "ua.read_at IS NULL"
+	args := []any{}
+
+	if f.Unseen {
+		cond += " AND IFNULL(ua.seen, FALSE) = FALSE"
+	}
+	if f.FolderId != 0 {
+		cond += " AND us.folder_id = ?"
+		args = append(args, f.FolderId)
 	}
 
-	return rl, nil
+	return r.list(userId, cond, args, p)
 }
 
-// AddToReadLater adds the article to the read later list.
-func (r ArticleRepository) AddToReadLater(a *Article) (err error) {
+// ArticlesInSubscription fetches a page of articles that belong to the subscription with the specified id.
+func (r ArticleRepository) ArticlesInSubscription(userId, id int64, p Page) ([]ArticleWithSubscription, *Cursor, error) {
+	return r.list(userId, "a.subscription_id = ?", []any{id}, p)
+}
+
+// ArticlesInFolder fetches a page of articles from all subscriptions in the folder with the specified id.
+func (r ArticleRepository) ArticlesInFolder(userId, folderId int64, p Page) ([]ArticleWithSubscription, *Cursor, error) {
+	return r.list(userId, "us.folder_id = ?", []any{folderId}, p)
+}
+
+// InReadLater returns a page of articles the user flagged as read later
+func (r ArticleRepository) InReadLater(userId int64, p Page) ([]ArticleWithSubscription, *Cursor, error) {
+	return r.list(userId, "ua.readlater = TRUE", nil, p)
+}
+
+// AddToReadLater adds the article to the read later list of the user.
+func (r ArticleRepository) AddToReadLater(userId int64, a *Article) (err error) {
 	now := time.Now().UTC().Format(time.DateTime)
 
-	_, err = r.db.Exec(`
-		UPDATE articles
-		SET
+	_, err = r.db.Exec(`INSERT INTO user_articles (user_id, article_id, readlater, created_readlater) VALUES (?, ?, TRUE, ?)
+		ON CONFLICT (user_id, article_id) DO UPDATE SET
 			readlater = TRUE,
-			created_readlater = ?
-		WHERE articles.id = ?`,
-		now, a.ID,
+			created_readlater = excluded.created_readlater`,
+		userId, a.ID, now,
 	)
 	if err != nil {
 		return
@@ -170,10 +253,10 @@ func (r ArticleRepository) AddToReadLater(a *Article) (err error) {
 	return
 }
 
-func (r ArticleRepository) RemoveFromReadLater(a *Article) (err error) {
-	res, err := r.db.NamedExec(
-		"UPDATE articles SET readlater = FALSE, created_readlater = NULL WHERE id = :id AND readlater = TRUE",
-		a,
+func (r ArticleRepository) RemoveFromReadLater(userId int64, a *Article) (err error) {
+	res, err := r.db.Exec(
+		"UPDATE user_articles SET readlater = FALSE, created_readlater = NULL WHERE user_id = ? AND article_id = ? AND readlater = TRUE",
+		userId, a.ID,
 	)
 	if err != nil {
 		return
@@ -184,28 +267,187 @@ func (r ArticleRepository) RemoveFromReadLater(a *Article) (err error) {
 		return sql.ErrNoRows
 	}
 
+	a.ReadLater = false
+	a.CreatedReadLater = sql.NullString{}
+	return
+}
+
+// InStarred returns a page of articles starred by the user
+func (r ArticleRepository) InStarred(userId int64, p Page) ([]ArticleWithSubscription, *Cursor, error) {
+	return r.list(userId, "ua.starred = TRUE", nil, p)
+}
+
+// Star adds the article to the starred articles of the user. Articles that are already starred keep the time they were starred.
+func (r ArticleRepository) Star(userId int64, a *Article) (err error) {
+	if !a.Starred {
+		a.StarredAt = sql.NullString{Valid: true, String: time.Now().UTC().Format(time.DateTime)}
+	}
+
+	_, err = r.db.Exec(`INSERT INTO user_articles (user_id, article_id, starred, starred_at) VALUES (?, ?, TRUE, ?)
+		ON CONFLICT (user_id, article_id) DO UPDATE SET starred = TRUE, starred_at = excluded.starred_at`,
+		userId, a.ID, a.StarredAt,
+	)
+	if err != nil {
+		return
+	}
+
+	a.Starred = true
+	return
+}
+
+// Unstar removes the article from the starred articles of the user. sql.ErrNoRows is returned if it wasn't starred.
+func (r ArticleRepository) Unstar(userId int64, a *Article) (err error) {
+	res, err := r.db.Exec(
+		"UPDATE user_articles SET starred = FALSE, starred_at = NULL WHERE user_id = ? AND article_id = ? AND starred = TRUE",
+		userId, a.ID,
+	)
+	if err != nil {
+		return
+	}
+
+	if aff, _ := res.RowsAffected(); aff == 0 {
+		return sql.ErrNoRows
+	}
+
+	a.Starred = false
+	a.StarredAt = sql.NullString{}
 	return
 }
 
-func (r ArticleRepository) MarkRead(a *Article) error {
+// MarkRead marks the article as read and seen by the user. Articles that were already read keep the time they were read.
+func (r ArticleRepository) MarkRead(userId int64, a *Article) error {
+	if !a.ReadAt.Valid {
+		a.ReadAt = sql.NullString{Valid: true, String: time.Now().UTC().Format(time.DateTime)}
+	}
+
 	// Also delete article from read later
-	_, err := r.db.NamedExec(
-		"UPDATE articles SET new = FALSE, readlater = FALSE, created_readlater = NULL WHERE id = :id",
-		a,
+	_, err := r.db.Exec(`INSERT INTO user_articles (user_id, article_id, read_at, seen) VALUES (?, ?, ?, TRUE)
+		ON CONFLICT (user_id, article_id) DO UPDATE SET
+			read_at = excluded.read_at, seen = TRUE, readlater = FALSE, created_readlater = NULL`,
+		userId, a.ID, a.ReadAt,
 	)
 	if err != nil {
 		return err
 	}
 
-	a.New = false
+	a.Seen = true
+	a.ReadLater = false
+	a.CreatedReadLater = sql.NullString{}
 
 	return nil
 }
 
+// MarkUnread marks the article as unread by the user. It stays seen, since it was already shown to the user.
+func (r ArticleRepository) MarkUnread(userId int64, a *Article) error {
+	_, err := r.db.Exec("UPDATE user_articles SET read_at = NULL WHERE user_id = ? AND article_id = ?", userId, a.ID)
+	if err != nil {
+		return err
+	}
+
+	a.ReadAt = sql.NullString{}
+
+	return nil
+}
+
+// MarkSeen records that the article was shown to the user, without marking it as read.
+func (r ArticleRepository) MarkSeen(userId int64, a *Article) error {
+	_, err := r.db.Exec(`INSERT INTO user_articles (user_id, article_id, seen) VALUES (?, ?, TRUE)
+		ON CONFLICT (user_id, article_id) DO UPDATE SET seen = TRUE`,
+		userId, a.ID,
+	)
+	if err != nil {
+		return err
+	}
+
+	a.Seen = true
+
+	return nil
+}
+
+// ErrEmptyFilter is returned when the filter would match all the articles.
+var ErrEmptyFilter = errors.New("filter must include ids, a subscription or a date")
+
+// MarkReadFilter selects the articles to be marked as read. Zero values mean no filtering.
+// At least one of Ids, SubscriptionId or OlderThan must be set.
+type MarkReadFilter struct {
+	Ids            []int64
+	SubscriptionId int64
+	FolderId       int64
+	// Only articles created before this time, in time.DateTime format
+	OlderThan string
+	// Only articles matching the full-text search query
+	Query string
+}
+
+// MarkManyRead marks all articles of the user matching the filter as read, the same way as MarkRead does,
+// and returns how many articles were affected. It is done with a single statement.
+func (r ArticleRepository) MarkManyRead(userId int64, f MarkReadFilter) (int64, error) {
+	if len(f.Ids) == 0 && f.SubscriptionId == 0 && f.OlderThan == "" {
+		return 0, ErrEmptyFilter
+	}
+
+	// Articles without a state row get one, the rest are updated by the upsert
+	q := `INSERT INTO user_articles (user_id, article_id, read_at, seen)
+		SELECT us.user_id, a.id, ?, TRUE
+		FROM articles a INNER JOIN user_subscriptions us ON us.subscription_id = a.subscription_id AND us.user_id = ?
+		LEFT JOIN user_articles ua ON ua.article_id = a.id AND ua.user_id = us.user_id
+		WHERE ua.read_at IS NULL`
+	args := []any{time.Now().UTC().Format(time.DateTime), userId}
+
+	if len(f.Ids) != 0 {
+		q += " AND a.id IN (?" + strings.Repeat(", ?", len(f.Ids)-1) + ")"
+		for _, id := range f.Ids {
+			args = append(args, id)
+		}
+	}
+	if f.SubscriptionId != 0 {
+		q += " AND a.subscription_id = ?"
+		args = append(args, f.SubscriptionId)
+	}
+	if f.FolderId != 0 {
+		q += " AND us.folder_id = ?"
+		args = append(args, f.FolderId)
+	}
+	if f.OlderThan != "" {
+		q += " AND a.created < ?"
+		args = append(args, f.OlderThan)
+	}
+	if f.Query != "" {
+		match, err := ftsQuery(f.Query)
+		if err != nil {
+			return 0, err
+		}
+		q += " AND a.id IN (SELECT rowid FROM articles_fts WHERE articles_fts MATCH ?)"
+		args = append(args, match)
+	}
+
+	q += ` ON CONFLICT (user_id, article_id) DO UPDATE SET
+		read_at = excluded.read_at, seen = TRUE, readlater = FALSE, created_readlater = NULL`
+
+	tx, err := r.db.Beginx()
+	if err != nil {
+		return 0, err
+	}
+
+	res, err := tx.Exec(q, args...)
+	if err != nil {
+		tx.Rollback()
+		return 0, err
+	}
+
+	affected, err := res.RowsAffected()
+	if err != nil {
+		tx.Rollback()
+		return 0, err
+	}
+
+	return affected, tx.Commit()
+}
+
 func (r ArticleRepository) InsertArticle(a *Article) (err error) {
 	res, err := r.db.NamedExec(`INSERT INTO articles
-		(subscription_id, new, url, title, description, thumbnail, created, readlater, created_readlater)
-		VALUES (:subscription_id, :new, :url, :title, :description, :thumbnail, :created, :readlater, :created_readlater)`,
+		(subscription_id, url, title, description, thumbnail, created, guid)
+		VALUES (:subscription_id, :url, :title, :description, :thumbnail, :created, :guid)`,
 		a,
 	)
 	if err != nil {
@@ -223,37 +465,76 @@ func (r ArticleRepository) InsertArticle(a *Article) (err error) {
 
 func (r ArticleRepository) UpdateArticle(db *sqlx.DB, a Article) (err error) {
 	_, err = r.db.NamedExec(`UPDATE articles SET
-		new = :new, url = :url, title = :title, description = :description, thumbnail = :thumbnail, created = :created, readlater = :readlater, created_readlater = :created_readlater
+		url = :url, title = :title, description = :description, thumbnail = :thumbnail, created = :created
 	WHERE articles.id = :id`,
 		a,
 	)
 	return
 }
 
-func (r ArticleRepository) BulkAddArticles(a []Article) (err error) {
+// BulkAddArticles inserts the articles in a single transaction.
+// Articles that are already in the database are updated if the publisher changed them, keeping their state for all the users.
+// Articles without the creation date get the current time when inserted, and keep their old date when updated.
+// IDs are set on the articles, and the number of inserted and updated ones is returned.
+func (r ArticleRepository) BulkAddArticles(a []Article) (added int, updated int, err error) {
 	tx, err := r.db.Beginx()
 	if err != nil {
-		return err
+		return 0, 0, err
 	}
 
+	// The unique index on (subscription_id, guid) decides which articles are new,
+	// so the cost depends only on the number of articles being added.
+	// Inserted rows are told apart from the updated ones by updated_at, which is only set on update.
 	stmt, err := tx.PrepareNamed(`INSERT INTO articles 
-		(subscription_id, new, url, title, description, thumbnail, created, readlater, created_readlater)
+		(subscription_id, url, title, description, thumbnail, created, guid)
 		VALUES 
-		(:subscription_id, :new, :url, :title, :description, :thumbnail, :created, :readlater, :created_readlater)`,
+		(:subscription_id, :url, :title, :description, :thumbnail, IFNULL(:created, datetime('now')), :guid)
+		ON CONFLICT (subscription_id, guid) DO UPDATE SET
+			url = excluded.url, title = excluded.title, description = excluded.description, thumbnail = excluded.thumbnail,
+			created = IFNULL(:created, created), updated_at = datetime('now')
+		WHERE title IS NOT excluded.title OR description IS NOT excluded.description OR thumbnail IS NOT excluded.thumbnail
+			OR created IS NOT IFNULL(:created, created)
+		RETURNING id, created, updated_at`,
 	)
 	if err != nil {
 		tx.Rollback()
-		return
+		return 0, 0, err
+	}
+	defer stmt.Close()
+
+	// Articles stored before the guids were introduced got their url as the guid. When the item has another guid,
+	// the old article takes it over, instead of the item being added again and losing the state of the users.
+	claim, err := tx.PrepareNamed(`UPDATE articles SET guid = :guid
+		WHERE subscription_id = :subscription_id AND url = :url AND guid = url AND guid != :guid
+			AND NOT EXISTS(SELECT 1 FROM articles a WHERE a.subscription_id = :subscription_id AND a.guid = :guid)`,
+	)
+	if err != nil {
+		tx.Rollback()
+		return 0, 0, err
 	}
+	defer claim.Close()
+
+	for i := range a {
+		if _, err := claim.Exec(a[i]); err != nil {
+			tx.Rollback()
+			return 0, 0, err
+		}
 
-	for _, art := range a {
-		if res, err := stmt.Exec(art); err != nil {
+		err := stmt.QueryRowx(a[i]).Scan(&a[i].ID, &a[i].Created, &a[i].UpdatedAt)
+		if errors.Is(err, sql.ErrNoRows) {
+			// Already exists, and didn't change
+			continue
+		} else if err != nil {
 			tx.Rollback()
-			return err
+			return 0, 0, err
+		}
+
+		if a[i].UpdatedAt.Valid {
+			updated++
 		} else {
-			art.ID, _ = res.LastInsertId()
+			added++
 		}
 	}
 
-	return tx.Commit()
+	return added, updated, tx.Commit()
 }
@@ -2,6 +2,7 @@ package database
 
 import (
 	"database/sql"
+	"strings"
 
 	"github.com/golang-migrate/migrate/v4"
 	"github.com/golang-migrate/migrate/v4/database/sqlite"
@@ -12,7 +13,7 @@ import (
 
 // NewWithMigrations creates the database at the given path, and runs the migrations using "file" driver
 func NewWithMigrations(dbPath string, migrationsPath string) (*sql.DB, error) {
-	db, err := sql.Open("sqlite", dbPath)
+	db, err := sql.Open("sqlite", withPragmas(dbPath))
 	if err != nil {
 		return nil, err
 	}
@@ -37,3 +38,15 @@ func NewWithMigrations(dbPath string, migrationsPath string) (*sql.DB, error) {
 
 	return db, nil
 }
+
+// withPragmas appends the pragmas that have to be set on every connection to the DSN.
+// Foreign keys are off by default in SQLite, and they are needed for cascading deletes.
+// Busy timeout makes concurrent writers wait for each other, instead of failing right away.
+func withPragmas(dbPath string) string {
+	sep := "?"
+	if strings.Contains(dbPath, "?") {
+		sep = "&"
+	}
+
+	return dbPath + sep + "_pragma=foreign_keys(1)&_pragma=busy_timeout(5000)"
+}
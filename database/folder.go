@@ -0,0 +1,100 @@
+package database
+
+import (
+	"database/sql"
+
+	"github.com/jmoiron/sqlx"
+)
+
+// Folder groups the subscriptions of a user. Titles are unique per user.
+type Folder struct {
+	ID     int64  `db:"id"`
+	UserId int64  `db:"user_id"`
+	Title  string `db:"title"`
+}
+
+type FolderRepository struct {
+	db *sqlx.DB
+}
+
+func NewFolderRepository(db *sqlx.DB) FolderRepository {
+	return FolderRepository{db}
+}
+
+// All returns the folders of the user, sorted by title.
+func (r FolderRepository) All(userId int64) ([]Folder, error) {
+	rows, err := r.db.Queryx("SELECT * FROM folders WHERE folders.user_id = ? ORDER BY folders.title", userId)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	f := []Folder{}
+	for rows.Next() {
+		folder := Folder{}
+		if err := rows.StructScan(&folder); err != nil {
+			return nil, err
+		}
+		f = append(f, folder)
+	}
+
+	return f, nil
+}
+
+// Find finds the folder of the user. sql.ErrNoRows is returned if the folder belongs to someone else.
+func (r FolderRepository) Find(userId, id int64) (*Folder, error) {
+	row := r.db.QueryRowx("SELECT * FROM folders WHERE folders.id = ? AND folders.user_id = ?", id, userId)
+
+	f := &Folder{}
+	if err := row.StructScan(f); err != nil {
+		return nil, err
+	}
+
+	return f, nil
+}
+
+func (r FolderRepository) FindByTitle(userId int64, title string) (*Folder, error) {
+	row := r.db.QueryRowx("SELECT * FROM folders WHERE folders.title = ? AND folders.user_id = ?", title, userId)
+
+	f := &Folder{}
+	if err := row.StructScan(f); err != nil {
+		return nil, err
+	}
+
+	return f, nil
+}
+
+// Insert inserts the folder of the user set on it into the database, and sets the ID property on it.
+func (r FolderRepository) Insert(f *Folder) error {
+	res, err := r.db.NamedExec("INSERT INTO folders (user_id, title) VALUES (:user_id, :title)", f)
+	if err != nil {
+		return err
+	}
+
+	id, err := res.LastInsertId()
+	if err != nil {
+		return err
+	}
+
+	f.ID = id
+	return nil
+}
+
+func (r FolderRepository) Update(f Folder) error {
+	_, err := r.db.NamedExec("UPDATE folders SET title = :title WHERE folders.id = :id AND folders.user_id = :user_id", f)
+	return err
+}
+
+// Delete deletes the folder. Subscriptions in it are not deleted, they just don't belong to any folder anymore.
+func (r FolderRepository) Delete(userId, id int64) error {
+	res, err := r.db.Exec("DELETE FROM folders WHERE folders.id = ? AND folders.user_id = ?", id, userId)
+	if err != nil {
+		return err
+	}
+
+	if aff, _ := res.RowsAffected(); aff == 0 {
+		return sql.ErrNoRows
+	}
+
+	return nil
+}
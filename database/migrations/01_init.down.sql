@@ -1,2 +1,2 @@
+DROP TABLE IF EXISTS articles;
 DROP TABLE IF EXISTS subscriptions;
-DROP TABLE IF EXISTS articles;
\ No newline at end of file
@@ -0,0 +1,17 @@
+CREATE TABLE articles_new (
+  id INTEGER PRIMARY KEY ASC,
+  subscription_id INTEGER NOT NULL,
+  new INT,
+  url TEXT NOT NULL,
+  title TEXT NOT NULL,
+  description TEXT,
+  thumbnail TEXT,
+  created TEXT NOT NULL,
+  readlater INTEGER NOT NULL,
+  created_readlater TEXT,
+  FOREIGN KEY(subscription_id) REFERENCES subscriptions(id)
+);
+INSERT INTO articles_new (id, subscription_id, new, url, title, description, thumbnail, created, readlater, created_readlater)
+SELECT id, subscription_id, new, url, title, description, thumbnail, created, readlater, created_readlater FROM articles;
+DROP TABLE articles;
+ALTER TABLE articles_new RENAME TO articles;
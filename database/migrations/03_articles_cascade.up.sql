@@ -0,0 +1,26 @@
+-- SQLite can't alter a foreign key in place, so the table has to be rebuilt
+CREATE TABLE articles_new (
+  id INTEGER PRIMARY KEY ASC,
+  -- feed that this article belongs to
+  subscription_id INTEGER NOT NULL,
+  -- whether the article was shown to the user
+  new INT,
+  -- URL to the article
+  url TEXT NOT NULL,
+  -- title of the article
+  title TEXT NOT NULL,
+  -- description of the article
+  description TEXT,
+  -- thumbnail URL, null if there's no thumbnail
+  thumbnail TEXT,
+  -- date when the article was written
+  created TEXT NOT NULL,
+  -- whether the article was added to the read later list
+  readlater INTEGER NOT NULL,
+  -- when the article was added to the read later list
+  created_readlater TEXT,
+  FOREIGN KEY(subscription_id) REFERENCES subscriptions(id) ON DELETE CASCADE
+);
+INSERT INTO articles_new SELECT * FROM articles;
+DROP TABLE articles;
+ALTER TABLE articles_new RENAME TO articles;
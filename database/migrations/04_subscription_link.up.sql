@@ -0,0 +1,2 @@
+-- link to the website of the feed
+ALTER TABLE subscriptions ADD COLUMN link TEXT;
@@ -0,0 +1,2 @@
+DROP TABLE IF EXISTS subscription_folders;
+DROP TABLE IF EXISTS folders;
@@ -0,0 +1,11 @@
+CREATE TABLE folders (
+  id INTEGER PRIMARY KEY ASC,
+  -- name of the folder that will be shown to the user
+  title TEXT NOT NULL UNIQUE
+);
+-- a subscription can be in at most one folder
+CREATE TABLE subscription_folders (
+  subscription_id INTEGER PRIMARY KEY REFERENCES subscriptions(id) ON DELETE CASCADE,
+  folder_id INTEGER NOT NULL REFERENCES folders(id) ON DELETE CASCADE
+);
+CREATE INDEX subscription_folders_folder_id ON subscription_folders(folder_id);
@@ -0,0 +1,18 @@
+-- full-text index over the articles, with the markup stripped from the descriptions.
+-- strip_html is a function registered by the application. The index keeps its own copy of the text, which the snippets are made of
+CREATE VIRTUAL TABLE articles_fts USING fts5(
+  title,
+  description,
+  tokenize='unicode61 remove_diacritics 2'
+);
+INSERT INTO articles_fts(rowid, title, description) SELECT id, title, strip_html(description) FROM articles;
+-- triggers that keep the index in sync with the articles table
+CREATE TRIGGER articles_fts_insert AFTER INSERT ON articles BEGIN
+  INSERT INTO articles_fts(rowid, title, description) VALUES (new.id, new.title, strip_html(new.description));
+END;
+CREATE TRIGGER articles_fts_delete AFTER DELETE ON articles BEGIN
+  DELETE FROM articles_fts WHERE rowid = old.id;
+END;
+CREATE TRIGGER articles_fts_update AFTER UPDATE OF title, description ON articles BEGIN
+  UPDATE articles_fts SET title = new.title, description = strip_html(new.description) WHERE rowid = new.id;
+END;
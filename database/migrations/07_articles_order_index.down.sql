@@ -0,0 +1,2 @@
+DROP INDEX IF EXISTS articles_created_id;
+DROP INDEX IF EXISTS articles_subscription_created_id;
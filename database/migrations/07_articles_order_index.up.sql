@@ -0,0 +1,3 @@
+-- indexes matching the order in which the articles are listed, used for pagination
+CREATE INDEX articles_created_id ON articles(created DESC, id DESC);
+CREATE INDEX articles_subscription_created_id ON articles(subscription_id, created DESC, id DESC);
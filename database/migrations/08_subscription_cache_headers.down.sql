@@ -0,0 +1,2 @@
+ALTER TABLE subscriptions DROP COLUMN etag;
+ALTER TABLE subscriptions DROP COLUMN last_modified;
@@ -0,0 +1,3 @@
+-- ETag and Last-Modified headers from the last response of the feed, sent back on the next refresh
+ALTER TABLE subscriptions ADD COLUMN etag TEXT;
+ALTER TABLE subscriptions ADD COLUMN last_modified TEXT;
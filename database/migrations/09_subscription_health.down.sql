@@ -0,0 +1,5 @@
+ALTER TABLE subscriptions DROP COLUMN last_success_at;
+ALTER TABLE subscriptions DROP COLUMN last_attempt_at;
+ALTER TABLE subscriptions DROP COLUMN failure_count;
+ALTER TABLE subscriptions DROP COLUMN last_status;
+ALTER TABLE subscriptions DROP COLUMN last_error;
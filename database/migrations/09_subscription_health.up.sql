@@ -0,0 +1,10 @@
+-- when the feed was last fetched successfully
+ALTER TABLE subscriptions ADD COLUMN last_success_at TEXT;
+-- when the feed was last fetched, successfully or not
+ALTER TABLE subscriptions ADD COLUMN last_attempt_at TEXT;
+-- number of refreshes in a row that failed
+ALTER TABLE subscriptions ADD COLUMN failure_count INTEGER NOT NULL DEFAULT 0;
+-- HTTP status of the last response, null if there was no response
+ALTER TABLE subscriptions ADD COLUMN last_status INTEGER;
+-- error from the last refresh, null if it was successful
+ALTER TABLE subscriptions ADD COLUMN last_error TEXT;
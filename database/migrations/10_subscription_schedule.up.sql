@@ -0,0 +1,2 @@
+-- when the feed should be fetched next, null if it should be fetched on the next refresh
+ALTER TABLE subscriptions ADD COLUMN next_refresh_at TEXT;
@@ -0,0 +1,3 @@
+DROP INDEX articles_legacy_guid;
+DROP INDEX articles_subscription_guid;
+ALTER TABLE articles DROP COLUMN guid;
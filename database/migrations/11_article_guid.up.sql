@@ -0,0 +1,9 @@
+-- stable identity of the article within its feed: the item's guid, its link, or a hash of its content
+ALTER TABLE articles ADD COLUMN guid TEXT NOT NULL DEFAULT '';
+-- existing articles were identified by their url, duplicates get the id appended to stay unique
+UPDATE articles SET guid = url WHERE id IN (SELECT MIN(id) FROM articles GROUP BY subscription_id, url);
+UPDATE articles SET guid = url || '#' || id WHERE guid = '';
+CREATE UNIQUE INDEX articles_subscription_guid ON articles(subscription_id, guid);
+-- articles stored before the guids have their url as the guid,
+-- and are looked up by url on refresh to take over the real guid of the item
+CREATE INDEX articles_legacy_guid ON articles(subscription_id, url) WHERE guid = url;
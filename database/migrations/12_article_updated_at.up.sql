@@ -0,0 +1,2 @@
+-- when the publisher last changed the article after it was added, null if it was never changed
+ALTER TABLE articles ADD COLUMN updated_at TEXT;
@@ -0,0 +1,2 @@
+DROP TRIGGER article_revisions_update;
+DROP TABLE article_revisions;
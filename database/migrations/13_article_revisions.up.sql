@@ -0,0 +1,19 @@
+-- previous versions of the articles, saved whenever the publisher changes the title or the description
+CREATE TABLE article_revisions (
+  id INTEGER PRIMARY KEY ASC,
+  article_id INTEGER NOT NULL REFERENCES articles(id) ON DELETE CASCADE,
+  title TEXT NOT NULL,
+  description TEXT,
+  -- since when this version was current
+  since TEXT NOT NULL,
+  -- when this version was replaced by the next one
+  replaced_at TEXT NOT NULL
+);
+CREATE INDEX article_revisions_article ON article_revisions(article_id, id);
+-- the trigger saves the old version, so that every code path that changes an article is covered
+CREATE TRIGGER article_revisions_update AFTER UPDATE OF title, description ON articles
+WHEN old.title IS NOT new.title OR old.description IS NOT new.description
+BEGIN
+  INSERT INTO article_revisions (article_id, title, description, since, replaced_at)
+  VALUES (old.id, old.title, old.description, IFNULL(old.updated_at, old.created), datetime('now'));
+END;
@@ -0,0 +1,4 @@
+ALTER TABLE articles ADD COLUMN new INT;
+UPDATE articles SET new = read_at IS NULL;
+ALTER TABLE articles DROP COLUMN read_at;
+ALTER TABLE articles DROP COLUMN seen;
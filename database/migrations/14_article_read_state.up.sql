@@ -0,0 +1,7 @@
+-- when the article was read, null if it is unread
+ALTER TABLE articles ADD COLUMN read_at TEXT;
+-- whether the article was shown to the user, read articles are always seen
+ALTER TABLE articles ADD COLUMN seen INTEGER NOT NULL DEFAULT FALSE;
+-- "new" was cleared when the article was read, the time of reading is not known
+UPDATE articles SET read_at = datetime('now'), seen = TRUE WHERE NOT IFNULL(new, TRUE);
+ALTER TABLE articles DROP COLUMN new;
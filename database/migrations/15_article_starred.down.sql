@@ -0,0 +1,3 @@
+DROP INDEX articles_starred;
+ALTER TABLE articles DROP COLUMN starred;
+ALTER TABLE articles DROP COLUMN starred_at;
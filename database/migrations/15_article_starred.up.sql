@@ -0,0 +1,5 @@
+-- whether the user starred the article, starred articles are kept permanently and must never be pruned
+ALTER TABLE articles ADD COLUMN starred INTEGER NOT NULL DEFAULT FALSE;
+-- when the article was starred
+ALTER TABLE articles ADD COLUMN starred_at TEXT;
+CREATE INDEX articles_starred ON articles(created DESC, id DESC) WHERE starred;
@@ -0,0 +1,2 @@
+-- human readable name of the token, to tell the tokens apart
+ALTER TABLE auth_tokens ADD COLUMN label TEXT;
@@ -0,0 +1,3 @@
+-- the digests can't be reversed, so the existing tokens stop working and new ones have to be created
+DROP INDEX auth_tokens_token_hash;
+ALTER TABLE auth_tokens RENAME COLUMN token_hash TO token;
@@ -0,0 +1,4 @@
+-- only the SHA-256 digests of the tokens are stored, token_digest is a function registered by the application
+ALTER TABLE auth_tokens RENAME COLUMN token TO token_hash;
+UPDATE auth_tokens SET token_hash = token_digest(token_hash);
+CREATE UNIQUE INDEX auth_tokens_token_hash ON auth_tokens(token_hash);
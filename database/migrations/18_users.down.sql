@@ -0,0 +1,45 @@
+-- only the state of the default user is kept
+ALTER TABLE articles ADD COLUMN readlater INTEGER NOT NULL DEFAULT FALSE;
+ALTER TABLE articles ADD COLUMN created_readlater TEXT;
+ALTER TABLE articles ADD COLUMN read_at TEXT;
+ALTER TABLE articles ADD COLUMN seen INTEGER NOT NULL DEFAULT FALSE;
+ALTER TABLE articles ADD COLUMN starred INTEGER NOT NULL DEFAULT FALSE;
+ALTER TABLE articles ADD COLUMN starred_at TEXT;
+UPDATE articles SET (read_at, seen, readlater, created_readlater, starred, starred_at) = (
+  SELECT read_at, seen, readlater, created_readlater, starred, starred_at FROM user_articles ua
+  WHERE ua.article_id = articles.id AND ua.user_id = 1
+)
+WHERE id IN (SELECT article_id FROM user_articles WHERE user_id = 1);
+CREATE INDEX articles_starred ON articles(created DESC, id DESC) WHERE starred;
+DROP TABLE user_articles;
+
+ALTER TABLE folders RENAME TO folders_users;
+CREATE TABLE folders (
+  id INTEGER PRIMARY KEY ASC,
+  title TEXT NOT NULL UNIQUE
+);
+INSERT INTO folders (id, title) SELECT id, title FROM folders_users WHERE user_id = 1;
+CREATE TABLE subscription_folders (
+  subscription_id INTEGER PRIMARY KEY REFERENCES subscriptions(id) ON DELETE CASCADE,
+  folder_id INTEGER NOT NULL REFERENCES folders(id) ON DELETE CASCADE
+);
+CREATE INDEX subscription_folders_folder_id ON subscription_folders(folder_id);
+INSERT INTO subscription_folders (subscription_id, folder_id)
+SELECT subscription_id, folder_id FROM user_subscriptions WHERE user_id = 1 AND folder_id IS NOT NULL;
+DROP TABLE user_subscriptions;
+DROP TABLE folders_users;
+
+CREATE TABLE auth_tokens_new (
+  id INTEGER PRIMARY KEY ASC,
+  token_hash TEXT NOT NULL,
+  created_at TEXT NOT NULL,
+  valid_until TEXT,
+  label TEXT
+);
+INSERT INTO auth_tokens_new (id, token_hash, created_at, valid_until, label)
+SELECT id, token_hash, created_at, valid_until, label FROM auth_tokens WHERE user_id = 1;
+DROP TABLE auth_tokens;
+ALTER TABLE auth_tokens_new RENAME TO auth_tokens;
+CREATE UNIQUE INDEX auth_tokens_token_hash ON auth_tokens(token_hash);
+
+DROP TABLE users;
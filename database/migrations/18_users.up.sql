@@ -0,0 +1,80 @@
+CREATE TABLE users (
+  id INTEGER PRIMARY KEY ASC,
+  name TEXT NOT NULL UNIQUE,
+  created_at TEXT NOT NULL
+);
+-- everything that existed before belongs to the default user
+INSERT INTO users (id, name, created_at) VALUES (1, 'default', datetime('now'));
+
+-- tokens are rebuilt, since a foreign key can't be added with ALTER TABLE
+CREATE TABLE auth_tokens_new (
+  id INTEGER PRIMARY KEY ASC,
+  user_id INTEGER NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+  token_hash TEXT NOT NULL,
+  created_at TEXT NOT NULL,
+  valid_until TEXT,
+  label TEXT
+);
+INSERT INTO auth_tokens_new (id, user_id, token_hash, created_at, valid_until, label)
+SELECT id, 1, token_hash, created_at, valid_until, label FROM auth_tokens;
+DROP TABLE auth_tokens;
+ALTER TABLE auth_tokens_new RENAME TO auth_tokens;
+CREATE UNIQUE INDEX auth_tokens_token_hash ON auth_tokens(token_hash);
+CREATE INDEX auth_tokens_user ON auth_tokens(user_id);
+
+-- folder titles are unique per user.
+-- The old table is renamed first, so that dropping it later doesn't cascade into the folders of the subscriptions.
+ALTER TABLE folders RENAME TO folders_old;
+CREATE TABLE folders (
+  id INTEGER PRIMARY KEY ASC,
+  user_id INTEGER NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+  title TEXT NOT NULL,
+  UNIQUE (user_id, title)
+);
+INSERT INTO folders (id, user_id, title) SELECT id, 1, title FROM folders_old;
+
+-- feeds are fetched and stored once, users subscribe to them.
+-- Title, description and thumbnail override the ones of the feed, when set.
+CREATE TABLE user_subscriptions (
+  user_id INTEGER NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+  subscription_id INTEGER NOT NULL REFERENCES subscriptions(id) ON DELETE CASCADE,
+  folder_id INTEGER REFERENCES folders(id) ON DELETE SET NULL,
+  title TEXT,
+  description TEXT,
+  thumbnail TEXT,
+  created_at TEXT NOT NULL,
+  PRIMARY KEY (user_id, subscription_id)
+);
+CREATE INDEX user_subscriptions_subscription ON user_subscriptions(subscription_id);
+CREATE INDEX user_subscriptions_folder ON user_subscriptions(folder_id);
+INSERT INTO user_subscriptions (user_id, subscription_id, folder_id, created_at)
+SELECT 1, s.id, sf.folder_id, datetime('now')
+FROM subscriptions s LEFT JOIN subscription_folders sf ON sf.subscription_id = s.id;
+DROP TABLE subscription_folders;
+DROP TABLE folders_old;
+
+-- read state of the articles. A missing row means the article is unread, unseen, not in read later and not starred.
+CREATE TABLE user_articles (
+  user_id INTEGER NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+  article_id INTEGER NOT NULL REFERENCES articles(id) ON DELETE CASCADE,
+  read_at TEXT,
+  seen INTEGER NOT NULL DEFAULT FALSE,
+  readlater INTEGER NOT NULL DEFAULT FALSE,
+  created_readlater TEXT,
+  -- starred articles are kept permanently and must never be pruned
+  starred INTEGER NOT NULL DEFAULT FALSE,
+  starred_at TEXT,
+  PRIMARY KEY (user_id, article_id)
+);
+CREATE INDEX user_articles_article ON user_articles(article_id);
+INSERT INTO user_articles (user_id, article_id, read_at, seen, readlater, created_readlater, starred, starred_at)
+SELECT 1, id, read_at, seen, readlater, created_readlater, starred, starred_at FROM articles
+WHERE read_at IS NOT NULL OR seen OR readlater OR starred;
+
+DROP INDEX articles_starred;
+ALTER TABLE articles DROP COLUMN read_at;
+ALTER TABLE articles DROP COLUMN seen;
+ALTER TABLE articles DROP COLUMN readlater;
+ALTER TABLE articles DROP COLUMN created_readlater;
+ALTER TABLE articles DROP COLUMN starred;
+ALTER TABLE articles DROP COLUMN starred_at;
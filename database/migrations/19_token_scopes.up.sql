@@ -0,0 +1,2 @@
+-- permissions of the token, separated by spaces. Existing tokens keep full access.
+ALTER TABLE auth_tokens ADD COLUMN scopes TEXT NOT NULL DEFAULT 'read write admin';
@@ -0,0 +1,6 @@
+-- bcrypt hash of the password of the user, null if the user can't log in with a password
+ALTER TABLE users ADD COLUMN password_hash TEXT;
+-- failed login attempts in a row, reset on a successful login
+ALTER TABLE users ADD COLUMN failed_logins INTEGER NOT NULL DEFAULT 0;
+-- logins are refused until this time after too many failed attempts
+ALTER TABLE users ADD COLUMN locked_until TEXT;
@@ -0,0 +1,5 @@
+ALTER TABLE auth_tokens DROP COLUMN rotated_at;
+ALTER TABLE auth_tokens DROP COLUMN idle_timeout;
+ALTER TABLE auth_tokens DROP COLUMN last_user_agent;
+ALTER TABLE auth_tokens DROP COLUMN last_ip;
+ALTER TABLE auth_tokens DROP COLUMN last_used_at;
@@ -0,0 +1,8 @@
+-- when the token was last used, and by which client. Updated in batches, so it can lag behind a bit.
+ALTER TABLE auth_tokens ADD COLUMN last_used_at TEXT;
+ALTER TABLE auth_tokens ADD COLUMN last_ip TEXT;
+ALTER TABLE auth_tokens ADD COLUMN last_user_agent TEXT;
+-- seconds of inactivity after which the token expires, 0 if it doesn't. Each use pushes valid_until forward.
+ALTER TABLE auth_tokens ADD COLUMN idle_timeout INTEGER NOT NULL DEFAULT 0;
+-- when the token was replaced by a new one. It stays valid for a short grace period after that.
+ALTER TABLE auth_tokens ADD COLUMN rotated_at TEXT;
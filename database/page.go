@@ -0,0 +1,45 @@
+package database
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+)
+
+// ErrInvalidCursor is returned when the cursor can't be decoded.
+var ErrInvalidCursor = errors.New("invalid cursor")
+
+// Cursor points at the last article of a page. Articles are listed newest first,
+// so the next page starts with the articles that come after the cursor in (created, id) order.
+type Cursor struct {
+	Created string `json:"c"`
+	ID      int64  `json:"i"`
+}
+
+// Encode returns the cursor as an opaque string, which can be passed around in URLs.
+func (c Cursor) Encode() string {
+	enc, _ := json.Marshal(c)
+	return base64.RawURLEncoding.EncodeToString(enc)
+}
+
+func DecodeCursor(s string) (*Cursor, error) {
+	dec, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return nil, ErrInvalidCursor
+	}
+
+	c := &Cursor{}
+	if err := json.Unmarshal(dec, c); err != nil || c.ID == 0 {
+		return nil, ErrInvalidCursor
+	}
+
+	return c, nil
+}
+
+// Page selects a part of a listing.
+type Page struct {
+	// Maximum number of articles on the page
+	Limit int
+	// When not nil, the page starts after the article this cursor points at
+	After *Cursor
+}
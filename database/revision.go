@@ -0,0 +1,38 @@
+package database
+
+import "database/sql"
+
+// Revision is a previous version of an article. Revisions are saved by a trigger, whenever the title or the description changes.
+type Revision struct {
+	ID          int64          `db:"id"`
+	ArticleId   int64          `db:"article_id"`
+	Title       string         `db:"title"`
+	Description sql.NullString `db:"description"`
+	// Since when this version was current
+	Since string `db:"since"`
+	// When this version was replaced by the next one
+	ReplacedAt string `db:"replaced_at"`
+}
+
+// Revisions returns the previous versions of the article, oldest first. The current version is not included.
+func (r ArticleRepository) Revisions(articleId int64) ([]Revision, error) {
+	rows, err := r.db.Queryx(
+		"SELECT * FROM article_revisions WHERE article_id = ? ORDER BY id",
+		articleId,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	revs := []Revision{}
+	for rows.Next() {
+		rev := Revision{}
+		if err := rows.StructScan(&rev); err != nil {
+			return nil, err
+		}
+		revs = append(revs, rev)
+	}
+
+	return revs, rows.Err()
+}
@@ -0,0 +1,191 @@
+package database
+
+import (
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"html"
+	"strings"
+	"unicode"
+
+	xhtml "golang.org/x/net/html"
+	"modernc.org/sqlite"
+)
+
+func init() {
+	// The full-text index is kept in sync by triggers, which index the descriptions without the markup
+	err := sqlite.RegisterDeterministicScalarFunction("strip_html", 1,
+		func(ctx *sqlite.FunctionContext, args []driver.Value) (driver.Value, error) {
+			switch v := args[0].(type) {
+			case string:
+				return plainText(v), nil
+			case []byte:
+				return plainText(string(v)), nil
+			default:
+				return v, nil
+			}
+		},
+	)
+	if err != nil {
+		panic(err)
+	}
+}
+
+// ErrEmptyQuery is returned when there's nothing to search for in the query.
+var ErrEmptyQuery = errors.New("empty search query")
+
+type SearchResult struct {
+	ArticleWithSubscription
+	// Part of the article that matched the query as escaped HTML, with the matches wrapped in <mark></mark>
+	Snippet string `db:"snippet"`
+}
+
+// SearchFilter narrows the search down. Zero values mean no filtering.
+type SearchFilter struct {
+	SubscriptionId int64
+	FolderId       int64
+	// When valid, only read (true) or unread (false) articles are returned
+	Read sql.NullBool
+	// Maximum number of results
+	Limit int
+}
+
+// Search finds the articles of the user matching the query, best matches first.
+//
+// Words in the query must all be present in the article, either in the title or in the description.
+// Words in double quotes are matched as a phrase, and a word ending with '*' matches any word starting with it.
+func (r ArticleRepository) Search(userId int64, query string, f SearchFilter) ([]SearchResult, error) {
+	match, err := ftsQuery(query)
+	if err != nil {
+		return nil, err
+	}
+
+	// The matches are marked with control characters first, since the text has to be escaped before it's returned as HTML
+	q := "SELECT " + articleJoinColumns + `,
+		snippet(articles_fts, -1, char(2), char(3), '…', 24) AS snippet
+	FROM articles_fts INNER JOIN ` + articleJoinTables + `
+	WHERE articles_fts MATCH ? AND a.id = articles_fts.rowid`
+	args := []any{userId, match}
+
+	if f.SubscriptionId != 0 {
+		q += " AND a.subscription_id = ?"
+		args = append(args, f.SubscriptionId)
+	}
+	if f.FolderId != 0 {
+		q += " AND us.folder_id = ?"
+		args = append(args, f.FolderId)
+	}
+	if f.Read.Valid {
+		q += " AND (ua.read_at IS NOT NULL) = ?"
+		args = append(args, f.Read.Bool)
+	}
+
+	q += " ORDER BY articles_fts.rank LIMIT ?"
+	args = append(args, f.Limit)
+
+	rows, err := r.db.Queryx(q, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	out := []SearchResult{}
+	for rows.Next() {
+		sr := SearchResult{}
+		if err := rows.StructScan(&sr); err != nil {
+			return nil, err
+		}
+		sr.Snippet = markMatches(sr.Snippet)
+		out = append(out, sr)
+	}
+
+	return out, rows.Err()
+}
+
+// markMatches escapes the snippet, and wraps the matches marked by the query in <mark></mark>
+func markMatches(snippet string) string {
+	return strings.NewReplacer("\x02", "<mark>", "\x03", "</mark>").Replace(html.EscapeString(snippet))
+}
+
+// plainText returns the text of the HTML, without the tags and with the entities decoded.
+// Scripts and styles aren't text, so they are left out.
+func plainText(s string) string {
+	b := strings.Builder{}
+	skip := false
+
+	z := xhtml.NewTokenizer(strings.NewReader(s))
+	for {
+		switch tt := z.Next(); tt {
+		case xhtml.ErrorToken:
+			return strings.Join(strings.Fields(b.String()), " ")
+		case xhtml.TextToken:
+			if !skip {
+				b.Write(z.Text())
+			}
+		case xhtml.StartTagToken, xhtml.EndTagToken, xhtml.SelfClosingTagToken:
+			name, _ := z.TagName()
+			if string(name) == "script" || string(name) == "style" {
+				skip = tt == xhtml.StartTagToken
+			}
+			// Tags often separate words, like in <p>one</p><p>two</p>
+			b.WriteByte(' ')
+		}
+	}
+}
+
+// ftsQuery converts the user query into the FTS5 query syntax.
+// Every word and phrase is quoted, so that characters that have a special meaning in FTS5 queries are searched for literally.
+func ftsQuery(query string) (string, error) {
+	terms := []string{}
+
+	// quote turns a word or a phrase into an FTS5 string
+	quote := func(s string) string {
+		return `"` + strings.ReplaceAll(s, `"`, `""`) + `"`
+	}
+
+	rest := query
+	for {
+		rest = strings.TrimLeftFunc(rest, unicode.IsSpace)
+		if rest == "" {
+			break
+		}
+
+		// Phrase in double quotes. An unterminated quote spans until the end of the query
+		if rest[0] == '"' {
+			phrase, after, _ := strings.Cut(rest[1:], `"`)
+			rest = after
+
+			if strings.TrimSpace(phrase) != "" {
+				terms = append(terms, quote(phrase))
+			}
+			continue
+		}
+
+		end := strings.IndexFunc(rest, func(r rune) bool {
+			return unicode.IsSpace(r) || r == '"'
+		})
+		if end == -1 {
+			end = len(rest)
+		}
+		word := rest[:end]
+		rest = rest[end:]
+
+		prefix := strings.HasSuffix(word, "*")
+		word = strings.TrimRight(word, "*")
+		if word == "" {
+			continue
+		}
+
+		if prefix {
+			terms = append(terms, quote(word)+"*")
+		} else {
+			terms = append(terms, quote(word))
+		}
+	}
+
+	if len(terms) == 0 {
+		return "", ErrEmptyQuery
+	}
+
+	return strings.Join(terms, " "), nil
+}
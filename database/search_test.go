@@ -0,0 +1,65 @@
+package database
+
+import "testing"
+
+func TestFtsQuery(t *testing.T) {
+	tests := map[string]struct {
+		query string
+		want  string
+	}{
+		"single word":           {"golang", `"golang"`},
+		"multiple words":        {"  go   sqlite ", `"go" "sqlite"`},
+		"phrase":                {`"full text" search`, `"full text" "search"`},
+		"unterminated phrase":   {`search "full text`, `"search" "full text"`},
+		"prefix":                {"data*", `"data"*`},
+		"operators are literal": {`go AND (c OR "rust`, `"go" "AND" "(c" "OR" "rust"`},
+		"quotes inside words":   {`it's a"b`, `"it's" "a" "b"`},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			got, err := ftsQuery(test.query)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+
+			if got != test.want {
+				t.Errorf("want '%v', got '%v'", test.want, got)
+			}
+		})
+	}
+
+	for _, query := range []string{"", "   ", `""`, "*", `" "`} {
+		if _, err := ftsQuery(query); err != ErrEmptyQuery {
+			t.Errorf("expected ErrEmptyQuery for '%v', got %v", query, err)
+		}
+	}
+}
+
+func TestPlainText(t *testing.T) {
+	tests := map[string]struct {
+		html string
+		want string
+	}{
+		"text":                {"plain text", "plain text"},
+		"tags":                {`<p class="intro">one <b>two</b></p><p>three</p>`, "one two three"},
+		"entities":            {"fish &amp; chips &lt;3", "fish & chips <3"},
+		"scripts and styles":  {"<style>p { color: red }</style>text<script>alert(1)</script>", "text"},
+		"unterminated markup": {"text <a href=", "text"},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			if got := plainText(test.html); got != test.want {
+				t.Errorf("want '%v', got '%v'", test.want, got)
+			}
+		})
+	}
+}
+
+func TestMarkMatches(t *testing.T) {
+	got := markMatches("fish & \x02chips\x03 <3")
+	if want := "fish &amp; <mark>chips</mark> &lt;3"; got != want {
+		t.Errorf("want '%v', got '%v'", want, got)
+	}
+}
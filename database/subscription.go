@@ -3,10 +3,24 @@ package database
 import (
 	"database/sql"
 	"errors"
+	"strings"
+	"time"
 
 	"github.com/jmoiron/sqlx"
 )
 
+// Extracted query used to query the feeds, regardless of who is subscribed to them
+const subscriptionQuery = `SELECT s.* FROM subscriptions s`
+
+// Extracted query used to query the subscriptions of a user, along with the folder they are in.
+// The user id is the first argument. Title, description and thumbnail set by the user override the ones of the feed.
+const userSubscriptionQuery = `SELECT s.id, s.type, s.url,
+	IFNULL(us.title, s.title) AS title, IFNULL(us.description, s.description) AS description, IFNULL(us.thumbnail, s.thumbnail) AS thumbnail,
+	s.link, s.etag, s.last_modified, s.last_success_at, s.last_attempt_at, s.failure_count, s.last_status, s.last_error, s.next_refresh_at,
+	us.folder_id
+FROM subscriptions s INNER JOIN user_subscriptions us ON us.subscription_id = s.id AND us.user_id = ?`
+
+// Subscription is a feed. Each distinct feed is stored and fetched once, no matter how many users are subscribed to it.
 type Subscription struct {
 	ID          int64          `db:"id"`
 	Type        string         `db:"type"`
@@ -14,6 +28,27 @@ type Subscription struct {
 	Title       string         `db:"title"`
 	Description sql.NullString `db:"description"`
 	Thumbnail   sql.NullString `db:"thumbnail"`
+	Link        sql.NullString `db:"link"`
+	// Cache validators from the last response of the feed
+	ETag         sql.NullString `db:"etag"`
+	LastModified sql.NullString `db:"last_modified"`
+	// Health of the feed, updated on each refresh
+	LastSuccessAt sql.NullString `db:"last_success_at"`
+	LastAttemptAt sql.NullString `db:"last_attempt_at"`
+	FailureCount  int64          `db:"failure_count"`
+	LastStatus    sql.NullInt64  `db:"last_status"`
+	LastError     sql.NullString `db:"last_error"`
+	// When the feed should be fetched next, in time.DateTime format
+	NextRefreshAt sql.NullString `db:"next_refresh_at"`
+	// Folder of the user, only set when queried for a user
+	FolderId sql.NullInt64 `db:"folder_id"`
+}
+
+// SubscriptionOverrides are set by the user over the values from the feed. Nil fields are left unchanged.
+type SubscriptionOverrides struct {
+	Title       *string
+	Description *string
+	Thumbnail   *string
 }
 
 type SubscriptionRepository struct {
@@ -24,11 +59,13 @@ func NewSubscriptionRepository(db *sqlx.DB) SubscriptionRepository {
 	return SubscriptionRepository{db}
 }
 
-func (r SubscriptionRepository) All() ([]Subscription, error) {
-	rows, err := r.db.Queryx("SELECT * FROM subscriptions")
+// query runs the query and scans all the subscriptions it returns.
+func (r SubscriptionRepository) query(q string, args ...any) ([]Subscription, error) {
+	rows, err := r.db.Queryx(q, args...)
 	if err != nil {
 		return nil, err
 	}
+	defer rows.Close()
 
 	s := []Subscription{}
 	for rows.Next() {
@@ -39,15 +76,90 @@ func (r SubscriptionRepository) All() ([]Subscription, error) {
 		s = append(s, sub)
 	}
 
-	return s, nil
+	return s, rows.Err()
 }
 
-func (r SubscriptionRepository) Find(id int64) (*Subscription, error) {
-	row := r.db.QueryRowx(`SELECT *
-		FROM subscriptions
-		WHERE subscriptions.id = ?`,
-		id,
+// All returns all the feeds.
+func (r SubscriptionRepository) All() ([]Subscription, error) {
+	return r.query(subscriptionQuery)
+}
+
+// ForUser returns the subscriptions of the user.
+func (r SubscriptionRepository) ForUser(userId int64) ([]Subscription, error) {
+	return r.query(userSubscriptionQuery, userId)
+}
+
+// WithStatus returns either the subscriptions of the user that failed to refresh the last time (failing = true), or the rest of them.
+func (r SubscriptionRepository) WithStatus(userId int64, failing bool) ([]Subscription, error) {
+	cond := " WHERE s.failure_count = 0"
+	if failing {
+		cond = " WHERE s.failure_count > 0"
+	}
+
+	return r.query(userSubscriptionQuery+cond, userId)
+}
+
+// Due returns the feeds that should be fetched at the given time.
+func (r SubscriptionRepository) Due(now time.Time) ([]Subscription, error) {
+	return r.query(
+		subscriptionQuery+" WHERE s.next_refresh_at IS NULL OR s.next_refresh_at <= ?",
+		now.UTC().Format(time.DateTime),
+	)
+}
+
+// DueForUser returns the feeds of the user that should be fetched at the given time.
+func (r SubscriptionRepository) DueForUser(userId int64, now time.Time) ([]Subscription, error) {
+	return r.query(
+		userSubscriptionQuery+" WHERE s.next_refresh_at IS NULL OR s.next_refresh_at <= ?",
+		userId, now.UTC().Format(time.DateTime),
+	)
+}
+
+// NextRefresh returns the earliest time at which any of the subscriptions should be fetched.
+// If there are no subscriptions, ok is false. Subscriptions that were never scheduled are due right away,
+// so the zero time is returned for them.
+func (r SubscriptionRepository) NextRefresh() (next time.Time, ok bool, err error) {
+	var count int64
+	var earliest sql.NullString
+	err = r.db.QueryRow(`SELECT COUNT(*), MIN(IFNULL(next_refresh_at, '')) FROM subscriptions`).Scan(&count, &earliest)
+	if err != nil || count == 0 {
+		return
+	}
+
+	ok = true
+	if earliest.String == "" {
+		return
+	}
+
+	next, err = time.Parse(time.DateTime, earliest.String)
+	return
+}
+
+// ScheduleRefresh sets the time at which the feed should be fetched next.
+func (r SubscriptionRepository) ScheduleRefresh(s *Subscription, next time.Time) error {
+	s.NextRefreshAt = sql.NullString{Valid: true, String: next.UTC().Format(time.DateTime)}
+
+	_, err := r.db.NamedExec(
+		"UPDATE subscriptions SET next_refresh_at = :next_refresh_at WHERE subscriptions.id = :id",
+		s,
 	)
+	return err
+}
+
+func (r SubscriptionRepository) Find(id int64) (*Subscription, error) {
+	row := r.db.QueryRowx(subscriptionQuery+" WHERE s.id = ?", id)
+
+	f := &Subscription{}
+	if err := row.StructScan(f); err != nil {
+		return nil, err
+	}
+
+	return f, nil
+}
+
+// FindForUser finds the subscription of the user. sql.ErrNoRows is returned if the user isn't subscribed to it.
+func (r SubscriptionRepository) FindForUser(userId, id int64) (*Subscription, error) {
+	row := r.db.QueryRowx(userSubscriptionQuery+" WHERE s.id = ?", userId, id)
 
 	f := &Subscription{}
 	if err := row.StructScan(f); err != nil {
@@ -58,11 +170,7 @@ func (r SubscriptionRepository) Find(id int64) (*Subscription, error) {
 }
 
 func (r SubscriptionRepository) FindByUrl(url string) (*Subscription, error) {
-	row := r.db.QueryRowx(`SELECT *
-		FROM subscriptions
-		WHERE subscriptions.url = ?`,
-		url,
-	)
+	row := r.db.QueryRowx(subscriptionQuery+" WHERE s.url = ?", url)
 
 	f := &Subscription{}
 	if err := row.StructScan(f); err != nil {
@@ -79,6 +187,7 @@ func (r SubscriptionRepository) SubscriptionExists(url string) (exists bool, id
 	} else if err != nil {
 		return
 	}
+	defer res.Close()
 
 	if !res.Next() {
 		err = res.Err()
@@ -95,8 +204,8 @@ func (r SubscriptionRepository) SubscriptionExists(url string) (exists bool, id
 // InsertSubscription inserts the given structure into the database, and sets the ID property on the Subscription.
 func (r SubscriptionRepository) InsertSubscription(s *Subscription) (err error) {
 	res, err := r.db.NamedExec(`INSERT INTO subscriptions
-		(type, url, title, description, thumbnail)
-		VALUES (:type, :url, :title, :description, :thumbnail)`,
+		(type, url, title, description, thumbnail, link)
+		VALUES (:type, :url, :title, :description, :thumbnail, :link)`,
 		s,
 	)
 	if err != nil {
@@ -114,9 +223,182 @@ func (r SubscriptionRepository) InsertSubscription(s *Subscription) (err error)
 
 func (r SubscriptionRepository) UpdateSubscription(s Subscription) (err error) {
 	_, err = r.db.NamedExec(`UPDATE subscriptions SET
-		type = :type, url = :url, title = :title, description = :description, thumbnail = :thumbnail
+		type = :type, url = :url, title = :title, description = :description, thumbnail = :thumbnail, link = :link,
+		etag = :etag, last_modified = :last_modified
 	WHERE subscriptions.id = :id`,
 		s,
 	)
 	return
 }
+
+// UpdateCacheHeaders stores the ETag and Last-Modified headers of the last response of the feed.
+func (r SubscriptionRepository) UpdateCacheHeaders(s *Subscription, etag, lastModified string) error {
+	s.ETag = sql.NullString{Valid: etag != "", String: etag}
+	s.LastModified = sql.NullString{Valid: lastModified != "", String: lastModified}
+
+	_, err := r.db.NamedExec(`UPDATE subscriptions SET
+		etag = :etag, last_modified = :last_modified
+	WHERE subscriptions.id = :id`,
+		s,
+	)
+	return err
+}
+
+// RecordAttempt updates the health of the feed after a refresh.
+// Status is the HTTP status of the response, or zero if there was none. A nil error means the refresh was successful.
+func (r SubscriptionRepository) RecordAttempt(s *Subscription, status int, refreshErr error) error {
+	now := sql.NullString{Valid: true, String: time.Now().UTC().Format(time.DateTime)}
+
+	s.LastAttemptAt = now
+	s.LastStatus = sql.NullInt64{Valid: status != 0, Int64: int64(status)}
+	if refreshErr == nil {
+		s.LastSuccessAt = now
+		s.FailureCount = 0
+		s.LastError = sql.NullString{}
+	} else {
+		s.FailureCount++
+		s.LastError = sql.NullString{Valid: true, String: refreshErr.Error()}
+	}
+
+	_, err := r.db.NamedExec(`UPDATE subscriptions SET
+		last_attempt_at = :last_attempt_at,
+		last_success_at = :last_success_at,
+		failure_count = :failure_count,
+		last_status = :last_status,
+		last_error = :last_error
+	WHERE subscriptions.id = :id`,
+		s,
+	)
+	return err
+}
+
+// Subscribe subscribes the user to the feed. Subscribing again does nothing.
+func (r SubscriptionRepository) Subscribe(userId int64, s *Subscription) error {
+	_, err := r.db.Exec(`INSERT INTO user_subscriptions (user_id, subscription_id, created_at) VALUES (?, ?, ?)
+		ON CONFLICT (user_id, subscription_id) DO NOTHING`,
+		userId, s.ID, time.Now().UTC().Format(time.DateTime),
+	)
+	return err
+}
+
+// IsSubscribed checks whether the user is subscribed to the feed.
+func (r SubscriptionRepository) IsSubscribed(userId, id int64) (subscribed bool, err error) {
+	err = r.db.QueryRow(
+		"SELECT EXISTS(SELECT 1 FROM user_subscriptions WHERE user_id = ? AND subscription_id = ?)",
+		userId, id,
+	).Scan(&subscribed)
+	return
+}
+
+// Subscribers returns how many users are subscribed to the feed.
+func (r SubscriptionRepository) Subscribers(id int64) (n int64, err error) {
+	err = r.db.QueryRow("SELECT COUNT(*) FROM user_subscriptions WHERE subscription_id = ?", id).Scan(&n)
+	return
+}
+
+// ErrStarredArticles is returned when unsubscribing would drop the articles the user starred
+var ErrStarredArticles = errors.New("the subscription has starred articles")
+
+// Unsubscribe unsubscribes the user from the feed, forgetting the state of its articles for the user.
+// When the last user unsubscribes, the feed is deleted along with its articles by the foreign key cascade.
+// Starred articles are meant to be kept, so ErrStarredArticles is returned if the user starred any, unless dropStarred is set.
+// sql.ErrNoRows is returned if the user wasn't subscribed.
+func (r SubscriptionRepository) Unsubscribe(userId, id int64, dropStarred bool) error {
+	tx, err := r.db.Beginx()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if !dropStarred {
+		var starred bool
+		err := tx.Get(&starred, `SELECT EXISTS(SELECT 1 FROM user_articles ua
+			INNER JOIN articles a ON a.id = ua.article_id
+			WHERE ua.user_id = ? AND a.subscription_id = ? AND ua.starred)`,
+			userId, id,
+		)
+		if err != nil {
+			return err
+		}
+		if starred {
+			return ErrStarredArticles
+		}
+	}
+
+	res, err := tx.Exec("DELETE FROM user_subscriptions WHERE user_id = ? AND subscription_id = ?", userId, id)
+	if err != nil {
+		return err
+	}
+	if aff, _ := res.RowsAffected(); aff == 0 {
+		return sql.ErrNoRows
+	}
+
+	_, err = tx.Exec(
+		"DELETE FROM user_articles WHERE user_id = ? AND article_id IN (SELECT id FROM articles WHERE subscription_id = ?)",
+		userId, id,
+	)
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.Exec(`DELETE FROM subscriptions WHERE subscriptions.id = ?
+		AND NOT EXISTS(SELECT 1 FROM user_subscriptions WHERE subscription_id = ?)`,
+		id, id,
+	)
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// Override sets the title, description or thumbnail of the subscription for the user only.
+func (r SubscriptionRepository) Override(userId int64, s *Subscription, o SubscriptionOverrides) error {
+	set := []string{}
+	args := []any{}
+
+	if o.Title != nil {
+		set = append(set, "title = ?")
+		args = append(args, *o.Title)
+		s.Title = *o.Title
+	}
+	if o.Description != nil {
+		set = append(set, "description = ?")
+		args = append(args, *o.Description)
+		s.Description = sql.NullString{Valid: *o.Description != "", String: *o.Description}
+	}
+	if o.Thumbnail != nil {
+		set = append(set, "thumbnail = ?")
+		args = append(args, *o.Thumbnail)
+		s.Thumbnail = sql.NullString{Valid: *o.Thumbnail != "", String: *o.Thumbnail}
+	}
+	if len(set) == 0 {
+		return nil
+	}
+
+	args = append(args, userId, s.ID)
+	_, err := r.db.Exec(
+		"UPDATE user_subscriptions SET "+strings.Join(set, ", ")+" WHERE user_id = ? AND subscription_id = ?",
+		args...,
+	)
+	return err
+}
+
+// InFolder returns the subscriptions of the user in the folder with the given id.
+func (r SubscriptionRepository) InFolder(userId, folderId int64) ([]Subscription, error) {
+	return r.query(userSubscriptionQuery+" WHERE us.folder_id = ?", userId, folderId)
+}
+
+// SetFolder moves the subscription of the user into the folder. If the folder id is not valid, the subscription is removed from its folder.
+func (r SubscriptionRepository) SetFolder(userId int64, s *Subscription, folderId sql.NullInt64) error {
+	_, err := r.db.Exec(
+		"UPDATE user_subscriptions SET folder_id = ? WHERE user_id = ? AND subscription_id = ?",
+		folderId, userId, s.ID,
+	)
+	if err != nil {
+		return err
+	}
+
+	s.FolderId = folderId
+	return nil
+}
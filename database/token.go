@@ -1,18 +1,73 @@
 package database
 
 import (
+	"crypto/sha256"
 	"database/sql"
+	"database/sql/driver"
+	"encoding/hex"
+	"errors"
 
 	"github.com/jmoiron/sqlx"
+	"modernc.org/sqlite"
 )
 
+func init() {
+	// The migration that hashes the existing tokens needs the digest function in SQL
+	err := sqlite.RegisterDeterministicScalarFunction("token_digest", 1,
+		func(ctx *sqlite.FunctionContext, args []driver.Value) (driver.Value, error) {
+			switch v := args[0].(type) {
+			case string:
+				return HashToken(v), nil
+			case []byte:
+				return HashToken(string(v)), nil
+			default:
+				return v, nil
+			}
+		},
+	)
+	if err != nil {
+		panic(err)
+	}
+}
+
+// HashToken returns the digest of the token, which is what is stored in the database.
+// Tokens are random 256-bit numbers, so a plain SHA-256 is enough to make the leaked digests useless.
+func HashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
 type Token struct {
-	ID         int64          `db:"id"`
-	Token      string         `db:"token"`
+	ID int64 `db:"id"`
+	// The user the token authenticates as
+	UserId int64 `db:"user_id"`
+	// Digest of the token, see HashToken. The token itself is never stored.
+	TokenHash  string         `db:"token_hash"`
 	CreatedAt  sql.NullString `db:"created_at"`
 	ValidUntil sql.NullString `db:"valid_until"`
+	Label      sql.NullString `db:"label"`
+	// Scopes of the token, separated by spaces
+	Scopes string `db:"scopes"`
+	// When the token was last used and by which client, see RecordUsage
+	LastUsedAt    sql.NullString `db:"last_used_at"`
+	LastIP        sql.NullString `db:"last_ip"`
+	LastUserAgent sql.NullString `db:"last_user_agent"`
+	// Seconds of inactivity after which the token expires, 0 if it only expires at ValidUntil
+	IdleTimeout int64 `db:"idle_timeout"`
+	// When the token was replaced by a new one, see Rotate
+	RotatedAt sql.NullString `db:"rotated_at"`
+}
+
+// TokenUsage is a use of the token by a client
+type TokenUsage struct {
+	ID        int64  `db:"id"`
+	UsedAt    string `db:"used_at"`
+	IP        string `db:"ip"`
+	UserAgent string `db:"user_agent"`
 }
 
+var ErrAlreadyRotated = errors.New("token was already rotated")
+
 type TokenRepository struct {
 	db *sqlx.DB
 }
@@ -21,11 +76,45 @@ func NewTokenRepository(db *sqlx.DB) TokenRepository {
 	return TokenRepository{db}
 }
 
+// All returns all tokens, oldest first.
+func (r TokenRepository) All() ([]Token, error) {
+	return r.query("SELECT * FROM auth_tokens ORDER BY auth_tokens.id")
+}
+
+// ForUser returns the tokens of the user, oldest first.
+func (r TokenRepository) ForUser(userId int64) ([]Token, error) {
+	return r.query("SELECT * FROM auth_tokens WHERE auth_tokens.user_id = ? ORDER BY auth_tokens.id", userId)
+}
+
+func (r TokenRepository) query(q string, args ...any) ([]Token, error) {
+	rows, err := r.db.Queryx(q, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	t := []Token{}
+	for rows.Next() {
+		token := Token{}
+		if err := rows.StructScan(&token); err != nil {
+			return nil, err
+		}
+		t = append(t, token)
+	}
+
+	return t, nil
+}
+
 // Find finds a token by it's value.
 func (r TokenRepository) Find(tokenStr string) (*Token, error) {
+	return r.FindByHash(HashToken(tokenStr))
+}
+
+// FindByHash finds a token by it's digest.
+func (r TokenRepository) FindByHash(hash string) (*Token, error) {
 	row := r.db.QueryRowx(`SELECT * FROM auth_tokens
-		WHERE auth_tokens.token = ?`,
-		tokenStr,
+		WHERE auth_tokens.token_hash = ?`,
+		hash,
 	)
 
 	token := Token{}
@@ -39,8 +128,8 @@ func (r TokenRepository) Find(tokenStr string) (*Token, error) {
 // Insert inserts a token into the database, and sets the id property on a token to the newly created row id.
 func (r TokenRepository) Insert(t *Token) (err error) {
 	res, err := r.db.NamedExec(`INSERT INTO auth_tokens
-		(token, created_at, valid_until)
-		VALUES (:token, :created_at, :valid_until)`,
+		(user_id, token_hash, created_at, valid_until, label, scopes, idle_timeout)
+		VALUES (:user_id, :token_hash, :created_at, :valid_until, :label, :scopes, :idle_timeout)`,
 		t,
 	)
 	if err != nil {
@@ -56,7 +145,108 @@ func (r TokenRepository) Insert(t *Token) (err error) {
 	return
 }
 
+// RecordUsage stores the last use of each token, and pushes the expiry of the tokens with an idle timeout forward.
+// Tokens that were deleted in the meantime are skipped.
+func (r TokenRepository) RecordUsage(usages []TokenUsage) error {
+	tx, err := r.db.Beginx()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	for _, u := range usages {
+		_, err := tx.NamedExec(`UPDATE auth_tokens SET
+			last_used_at = :used_at, last_ip = :ip, last_user_agent = :user_agent,
+			valid_until = CASE WHEN idle_timeout > 0
+				THEN MAX(valid_until, datetime(:used_at, '+' || idle_timeout || ' seconds'))
+				ELSE valid_until
+			END
+		WHERE auth_tokens.id = :id`,
+			u,
+		)
+		if err != nil {
+			return err
+		}
+	}
+
+	return tx.Commit()
+}
+
+// Rotate replaces the token with a new one, and sets the id on the new token.
+// The old token stays valid until graceUntil, and no longer extends its expiry on use.
+// ErrAlreadyRotated is returned if the old token was replaced before, and sql.ErrNoRows if it doesn't exist.
+func (r TokenRepository) Rotate(oldId int64, graceUntil string, replacement *Token) error {
+	tx, err := r.db.Beginx()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	// The old token is marked first, so that of two concurrent rotations only one succeeds
+	res, err := tx.Exec(`UPDATE auth_tokens SET
+		rotated_at = datetime('now'), idle_timeout = 0, valid_until = MIN(IFNULL(valid_until, ?), ?)
+	WHERE auth_tokens.id = ? AND auth_tokens.rotated_at IS NULL`,
+		graceUntil, graceUntil, oldId,
+	)
+	if err != nil {
+		return err
+	}
+	if aff, _ := res.RowsAffected(); aff == 0 {
+		var exists bool
+		if err := tx.Get(&exists, "SELECT EXISTS(SELECT 1 FROM auth_tokens WHERE auth_tokens.id = ?)", oldId); err != nil {
+			return err
+		}
+		if exists {
+			return ErrAlreadyRotated
+		}
+		return sql.ErrNoRows
+	}
+
+	res, err = tx.NamedExec(`INSERT INTO auth_tokens
+		(user_id, token_hash, created_at, valid_until, label, scopes, idle_timeout)
+		VALUES (:user_id, :token_hash, :created_at, :valid_until, :label, :scopes, :idle_timeout)`,
+		replacement,
+	)
+	if err != nil {
+		return err
+	}
+	id, err := res.LastInsertId()
+	if err != nil {
+		return err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return err
+	}
+
+	replacement.ID = id
+	return nil
+}
+
 func (r TokenRepository) Delete(t Token) (err error) {
-	_, err = r.db.NamedExec(`DELETE FROM auth_tokens WHERE id = :id OR token = :token`, t)
+	_, err = r.db.NamedExec(`DELETE FROM auth_tokens WHERE id = :id OR token_hash = :token_hash`, t)
 	return
 }
+
+// DeleteById deletes the token with the given id. sql.ErrNoRows is returned if there's no such token.
+func (r TokenRepository) DeleteById(id int64) error {
+	return r.deleteWhere("id = ?", id)
+}
+
+// DeleteForUser deletes the token of the user. sql.ErrNoRows is returned if the user has no such token.
+func (r TokenRepository) DeleteForUser(userId, id int64) error {
+	return r.deleteWhere("id = ? AND user_id = ?", id, userId)
+}
+
+func (r TokenRepository) deleteWhere(cond string, args ...any) error {
+	res, err := r.db.Exec("DELETE FROM auth_tokens WHERE "+cond, args...)
+	if err != nil {
+		return err
+	}
+
+	if aff, _ := res.RowsAffected(); aff == 0 {
+		return sql.ErrNoRows
+	}
+
+	return nil
+}
@@ -0,0 +1,54 @@
+package database
+
+import (
+	"database/sql"
+	"path/filepath"
+	"testing"
+
+	"github.com/golang-migrate/migrate/v4"
+	"github.com/golang-migrate/migrate/v4/database/sqlite"
+	"github.com/jmoiron/sqlx"
+)
+
+// Tokens that were stored before hashing was introduced keep working after the migration
+func TestHashExistingTokens(t *testing.T) {
+	const plain = "existing-token"
+
+	path := filepath.Join(t.TempDir(), "tokens.sqlite")
+	godb, err := sql.Open("sqlite", withPragmas(path))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer godb.Close()
+
+	driver, err := sqlite.WithInstance(godb, &sqlite.Config{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	m, err := migrate.NewWithDatabaseInstance("file://migrations", "sqlite", driver)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Last migration before the tokens were hashed
+	if err := m.Migrate(16); err != nil {
+		t.Fatal(err)
+	}
+	_, err = godb.Exec("INSERT INTO auth_tokens (token, created_at) VALUES (?, '2024-12-24 00:00:00')", plain)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := m.Up(); err != nil {
+		t.Fatal(err)
+	}
+
+	repo := NewTokenRepository(sqlx.NewDb(godb, "sqlite"))
+	tok, err := repo.Find(plain)
+	if err != nil {
+		t.Fatalf("existing token was not found after the migration: %v", err)
+	}
+	if tok.TokenHash != HashToken(plain) {
+		t.Errorf("expected the digest of the token to be stored, got %v", tok.TokenHash)
+	}
+}
@@ -0,0 +1,213 @@
+package database
+
+import (
+	"database/sql"
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+	"golang.org/x/crypto/bcrypt"
+)
+
+// DefaultUserId is the id of the user created by the migration, which owns everything that existed before users were introduced.
+const DefaultUserId int64 = 1
+
+type User struct {
+	ID        int64  `db:"id"`
+	Name      string `db:"name"`
+	CreatedAt string `db:"created_at"`
+	// bcrypt hash of the password, see HashPassword. Users without a password can't log in.
+	PasswordHash sql.NullString `db:"password_hash"`
+	// Failed login attempts in a row, and until when the logins are refused because of them
+	FailedLogins int64          `db:"failed_logins"`
+	LockedUntil  sql.NullString `db:"locked_until"`
+}
+
+// HashPassword returns the bcrypt hash of the password, which is what is stored in the database.
+func HashPassword(password string) (string, error) {
+	hash, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+	return string(hash), err
+}
+
+// Hash compared against when the user doesn't exist, so that the response takes as long as for the existing users
+var dummyHash = sync.OnceValue(func() []byte {
+	hash, _ := bcrypt.GenerateFromPassword([]byte("dummy password"), bcrypt.DefaultCost)
+	return hash
+})
+
+// CheckPassword reports whether the password matches the one of the user. It takes the same time for users without a password.
+func (u *User) CheckPassword(password string) bool {
+	if u == nil || !u.PasswordHash.Valid {
+		bcrypt.CompareHashAndPassword(dummyHash(), []byte(password))
+		return false
+	}
+
+	return bcrypt.CompareHashAndPassword([]byte(u.PasswordHash.String), []byte(password)) == nil
+}
+
+// Locked reports whether the logins of the user are refused at the given time.
+func (u User) Locked(now time.Time) bool {
+	return u.LockedUntil.Valid && u.LockedUntil.String > now.UTC().Format(time.DateTime)
+}
+
+type UserRepository struct {
+	db *sqlx.DB
+}
+
+func NewUserRepository(db *sqlx.DB) UserRepository {
+	return UserRepository{db}
+}
+
+func (r UserRepository) Find(id int64) (*User, error) {
+	row := r.db.QueryRowx("SELECT * FROM users WHERE users.id = ?", id)
+
+	u := &User{}
+	if err := row.StructScan(u); err != nil {
+		return nil, err
+	}
+
+	return u, nil
+}
+
+func (r UserRepository) FindByName(name string) (*User, error) {
+	row := r.db.QueryRowx("SELECT * FROM users WHERE users.name = ?", name)
+
+	u := &User{}
+	if err := row.StructScan(u); err != nil {
+		return nil, err
+	}
+
+	return u, nil
+}
+
+// Insert inserts the user into the database, and sets the ID and CreatedAt properties on it.
+func (r UserRepository) Insert(u *User) error {
+	u.CreatedAt = time.Now().UTC().Format(time.DateTime)
+
+	res, err := r.db.NamedExec("INSERT INTO users (name, created_at) VALUES (:name, :created_at)", u)
+	if err != nil {
+		return err
+	}
+
+	id, err := res.LastInsertId()
+	if err != nil {
+		return err
+	}
+
+	u.ID = id
+	return nil
+}
+
+// SetPassword stores the hash of the new password of the user, and lifts the lockout.
+func (r UserRepository) SetPassword(u *User, password string) error {
+	hash, err := HashPassword(password)
+	if err != nil {
+		return err
+	}
+
+	u.PasswordHash = sql.NullString{Valid: true, String: hash}
+	u.FailedLogins = 0
+	u.LockedUntil = sql.NullString{}
+
+	_, err = r.db.NamedExec(`UPDATE users SET
+		password_hash = :password_hash, failed_logins = :failed_logins, locked_until = :locked_until
+	WHERE users.id = :id`,
+		u,
+	)
+	return err
+}
+
+// RecordFailedLogin counts the failed login attempt, and returns the number of failed logins in a row.
+// The counter is incremented by the database, so that concurrent attempts are all counted.
+func (r UserRepository) RecordFailedLogin(u *User) (int64, error) {
+	row := r.db.QueryRowx(
+		"UPDATE users SET failed_logins = failed_logins + 1 WHERE users.id = ? RETURNING failed_logins",
+		u.ID,
+	)
+	if err := row.Scan(&u.FailedLogins); err != nil {
+		return 0, err
+	}
+
+	return u.FailedLogins, nil
+}
+
+// LockUntil refuses the logins of the user until the given time. A lockout that ends later is kept.
+func (r UserRepository) LockUntil(u *User, until time.Time) error {
+	row := r.db.QueryRowx(
+		"UPDATE users SET locked_until = MAX(IFNULL(locked_until, ''), ?) WHERE users.id = ? RETURNING locked_until",
+		until.UTC().Format(time.DateTime), u.ID,
+	)
+	return row.Scan(&u.LockedUntil)
+}
+
+// ResetFailedLogins forgets the failed login attempts after a successful login.
+func (r UserRepository) ResetFailedLogins(u *User) error {
+	u.FailedLogins = 0
+	u.LockedUntil = sql.NullString{}
+
+	_, err := r.db.NamedExec(
+		"UPDATE users SET failed_logins = 0, locked_until = NULL WHERE users.id = :id",
+		u,
+	)
+	return err
+}
+
+// FindByIdentity finds the user that the account at the OpenID Connect provider belongs to.
+func (r UserRepository) FindByIdentity(issuer, subject string) (*User, error) {
+	row := r.db.QueryRowx(`SELECT u.* FROM users u
+		JOIN user_identities i ON i.user_id = u.id
+		WHERE i.issuer = ? AND i.subject = ?`,
+		issuer, subject,
+	)
+
+	u := &User{}
+	if err := row.StructScan(u); err != nil {
+		return nil, err
+	}
+
+	return u, nil
+}
+
+var ErrIdentityTaken = errors.New("identity already belongs to a user")
+
+// InsertWithIdentity inserts the user linked to the account at the OpenID Connect provider, and sets the ID and CreatedAt properties on it.
+// Both are inserted in one transaction, so that no user is left without the identity.
+// ErrIdentityTaken is returned if the account was linked to another user in the meantime.
+func (r UserRepository) InsertWithIdentity(u *User, issuer, subject string) error {
+	tx, err := r.db.Beginx()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	createdAt := time.Now().UTC().Format(time.DateTime)
+	res, err := tx.Exec("INSERT INTO users (name, created_at) VALUES (?, ?)", u.Name, createdAt)
+	if err != nil {
+		return err
+	}
+	id, err := res.LastInsertId()
+	if err != nil {
+		return err
+	}
+
+	res, err = tx.Exec(
+		`INSERT INTO user_identities (issuer, subject, user_id, created_at) VALUES (?, ?, ?, ?)
+		ON CONFLICT (issuer, subject) DO NOTHING`,
+		issuer, subject, id, createdAt,
+	)
+	if err != nil {
+		return err
+	}
+	if aff, _ := res.RowsAffected(); aff == 0 {
+		return ErrIdentityTaken
+	}
+
+	if err := tx.Commit(); err != nil {
+		return err
+	}
+
+	u.ID = id
+	u.CreatedAt = createdAt
+	return nil
+}
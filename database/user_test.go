@@ -0,0 +1,118 @@
+package database
+
+import (
+	"database/sql"
+	"path/filepath"
+	"testing"
+
+	"github.com/golang-migrate/migrate/v4"
+	"github.com/golang-migrate/migrate/v4/database/sqlite"
+	"github.com/jmoiron/sqlx"
+)
+
+// Everything that existed before users were introduced belongs to the default user after the migration
+func TestMigrateToDefaultUser(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "users.sqlite")
+	godb, err := sql.Open("sqlite", withPragmas(path))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer godb.Close()
+
+	driver, err := sqlite.WithInstance(godb, &sqlite.Config{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	m, err := migrate.NewWithDatabaseInstance("file://migrations", "sqlite", driver)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Last migration before the users
+	if err := m.Migrate(17); err != nil {
+		t.Fatal(err)
+	}
+	for _, q := range []string{
+		"INSERT INTO folders (title) VALUES ('News')",
+		"INSERT INTO subscriptions (type, url, title) VALUES ('rss', 'https://example.com/rss.xml', 'Feed')",
+		"INSERT INTO subscription_folders (subscription_id, folder_id) VALUES (1, 1)",
+		`INSERT INTO articles (subscription_id, url, title, created, guid, read_at, seen, readlater, starred, starred_at) VALUES
+			(1, 'https://example.com/read', 'Read', '2024-12-24 00:00:00', 'read', '2024-12-25 00:00:00', TRUE, FALSE, TRUE, '2024-12-26 00:00:00'),
+			(1, 'https://example.com/unread', 'Unread', '2024-12-24 00:00:00', 'unread', NULL, FALSE, FALSE, FALSE, NULL)`,
+		"INSERT INTO auth_tokens (token_hash, created_at) VALUES ('digest', '2024-12-24 00:00:00')",
+	} {
+		if _, err := godb.Exec(q); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if err := m.Up(); err != nil {
+		t.Fatal(err)
+	}
+	db := sqlx.NewDb(godb, "sqlite")
+
+	subs, err := NewSubscriptionRepository(db).ForUser(DefaultUserId)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(subs) != 1 || subs[0].FolderId.Int64 != 1 {
+		t.Errorf("expected the subscription to stay in its folder, got %+v", subs)
+	}
+
+	if _, err := NewFolderRepository(db).Find(DefaultUserId, 1); err != nil {
+		t.Errorf("folder was not moved to the default user: %v", err)
+	}
+
+	ar := NewArticleRepository(db)
+	read, err := ar.FindForUser(DefaultUserId, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if read.ReadAt.String != "2024-12-25 00:00:00" || !read.Seen || !read.Starred || read.StarredAt.String != "2024-12-26 00:00:00" {
+		t.Errorf("state of the read article was lost: %+v", read.Article)
+	}
+	unread, err := ar.FindForUser(DefaultUserId, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if unread.ReadAt.Valid || unread.Seen || unread.Starred {
+		t.Errorf("unexpected state of the unread article: %+v", unread.Article)
+	}
+
+	tok, err := NewTokenRepository(db).FindByHash("digest")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if tok.UserId != DefaultUserId {
+		t.Errorf("token was not given to the default user: %+v", tok)
+	}
+}
+
+// A user isn't created for an account that another user was linked to in the meantime
+func TestInsertWithIdentity(t *testing.T) {
+	godb, err := NewWithMigrations(":memory:", "migrations")
+	if err != nil {
+		t.Fatal(err)
+	}
+	db := sqlx.NewDb(godb, "sqlite")
+	defer db.Close()
+
+	ur := NewUserRepository(db)
+	first := &User{Name: "first"}
+	if err := ur.InsertWithIdentity(first, "https://issuer.example.com", "subject"); err != nil {
+		t.Fatal(err)
+	}
+
+	second := &User{Name: "second"}
+	if err := ur.InsertWithIdentity(second, "https://issuer.example.com", "subject"); err != ErrIdentityTaken {
+		t.Errorf("expected ErrIdentityTaken, got %v", err)
+	}
+	if _, err := ur.FindByName("second"); err != sql.ErrNoRows {
+		t.Errorf("user was created without the identity: %v", err)
+	}
+
+	u, err := ur.FindByIdentity("https://issuer.example.com", "subject")
+	if err != nil || u.ID != first.ID {
+		t.Errorf("expected the identity to belong to the first user, got %+v %v", u, err)
+	}
+}
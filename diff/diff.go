@@ -0,0 +1,149 @@
+// diff package compares texts line by line, and formats the difference as a unified diff
+
+package diff
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Number of unchanged lines shown around each change
+const context = 3
+
+// Single line of the edit script
+type op struct {
+	// ' ' if the line is in both texts, '-' if it was removed, '+' if it was added
+	kind byte
+	line string
+}
+
+// Unified returns the unified diff between the two texts, or an empty string if they are the same.
+// The names are used in the file header of the diff.
+func Unified(fromName, toName, from, to string) string {
+	ops := script(lines(from), lines(to))
+
+	hunks := hunkRanges(ops)
+	if len(hunks) == 0 {
+		return ""
+	}
+
+	b := &strings.Builder{}
+	fmt.Fprintf(b, "--- %v\n+++ %v\n", fromName, toName)
+
+	for _, h := range hunks {
+		// Line numbers of the hunk start, in both texts
+		fromLine, toLine := 1, 1
+		for _, o := range ops[:h[0]] {
+			if o.kind != '+' {
+				fromLine++
+			}
+			if o.kind != '-' {
+				toLine++
+			}
+		}
+
+		fromCount, toCount := 0, 0
+		for _, o := range ops[h[0]:h[1]] {
+			if o.kind != '+' {
+				fromCount++
+			}
+			if o.kind != '-' {
+				toCount++
+			}
+		}
+
+		fmt.Fprintf(b, "@@ -%v +%v @@\n", hunkRange(fromLine, fromCount), hunkRange(toLine, toCount))
+		for _, o := range ops[h[0]:h[1]] {
+			b.WriteByte(o.kind)
+			b.WriteString(o.line)
+			b.WriteByte('\n')
+		}
+	}
+
+	return b.String()
+}
+
+func lines(s string) []string {
+	if s == "" {
+		return nil
+	}
+
+	return strings.Split(strings.TrimSuffix(s, "\n"), "\n")
+}
+
+// script finds the shortest edit script that turns a into b, using the longest common subsequence of the lines
+func script(a, b []string) []op {
+	// lcs[i][j] is the length of the longest common subsequence of a[i:] and b[j:]
+	lcs := make([][]int, len(a)+1)
+	for i := range lcs {
+		lcs[i] = make([]int, len(b)+1)
+	}
+	for i := len(a) - 1; i >= 0; i-- {
+		for j := len(b) - 1; j >= 0; j-- {
+			if a[i] == b[j] {
+				lcs[i][j] = lcs[i+1][j+1] + 1
+			} else {
+				lcs[i][j] = max(lcs[i+1][j], lcs[i][j+1])
+			}
+		}
+	}
+
+	ops := []op{}
+	i, j := 0, 0
+	for i < len(a) && j < len(b) {
+		switch {
+		case a[i] == b[j]:
+			ops = append(ops, op{' ', a[i]})
+			i++
+			j++
+		case lcs[i+1][j] >= lcs[i][j+1]:
+			ops = append(ops, op{'-', a[i]})
+			i++
+		default:
+			ops = append(ops, op{'+', b[j]})
+			j++
+		}
+	}
+	for ; i < len(a); i++ {
+		ops = append(ops, op{'-', a[i]})
+	}
+	for ; j < len(b); j++ {
+		ops = append(ops, op{'+', b[j]})
+	}
+
+	return ops
+}
+
+// hunkRanges groups the changes, along with the lines around them, into [start, end) ranges of the edit script.
+// Changes that are close enough to share the context lines end up in the same hunk.
+func hunkRanges(ops []op) [][2]int {
+	hunks := [][2]int{}
+
+	for i, o := range ops {
+		if o.kind == ' ' {
+			continue
+		}
+
+		start, end := max(i-context, 0), min(i+context+1, len(ops))
+		if n := len(hunks); n != 0 && start <= hunks[n-1][1] {
+			hunks[n-1][1] = end
+		} else {
+			hunks = append(hunks, [2]int{start, end})
+		}
+	}
+
+	return hunks
+}
+
+// hunkRange formats the line range the same way as GNU diff does
+func hunkRange(line, count int) string {
+	switch count {
+	case 0:
+		// Empty ranges point at the line before the change
+		return fmt.Sprintf("%v,0", line-1)
+	case 1:
+		return fmt.Sprint(line)
+	default:
+		return fmt.Sprintf("%v,%v", line, count)
+	}
+}
@@ -0,0 +1,53 @@
+package diff_test
+
+import (
+	"testing"
+
+	"github.com/3elDU/rss-reader-backend/diff"
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestUnified(t *testing.T) {
+	tests := map[string]struct {
+		from, to string
+		want     string
+	}{
+		"same": {
+			"one\ntwo\n",
+			"one\ntwo\n",
+			"",
+		},
+		"changed line": {
+			"title\n\nfirst\nsecond\nthird\n",
+			"title\n\nfirst\nsecond, corrected\nthird\n",
+			"--- a\n+++ b\n" +
+				"@@ -1,5 +1,5 @@\n" +
+				" title\n \n first\n-second\n+second, corrected\n third\n",
+		},
+		"from empty": {
+			"",
+			"one\ntwo",
+			"--- a\n+++ b\n" +
+				"@@ -0,0 +1,2 @@\n" +
+				"+one\n+two\n",
+		},
+		"separate hunks": {
+			"1\n2\n3\n4\n5\n6\n7\n8\n9\n10\n11\n12\n",
+			"1\nchanged\n3\n4\n5\n6\n7\n8\n9\n10\n12\n",
+			"--- a\n+++ b\n" +
+				"@@ -1,5 +1,5 @@\n" +
+				" 1\n-2\n+changed\n 3\n 4\n 5\n" +
+				"@@ -8,5 +8,4 @@\n" +
+				" 8\n 9\n 10\n-11\n 12\n",
+		},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			got := diff.Unified("a", "b", test.from, test.to)
+			if d := cmp.Diff(test.want, got); d != "" {
+				t.Errorf("unexpected diff (-want +got):\n%v", d)
+			}
+		})
+	}
+}
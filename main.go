@@ -1,15 +1,24 @@
 package main
 
 import (
+	"bufio"
+	"context"
+	"database/sql"
+	"errors"
 	"flag"
 	"fmt"
+	"io"
 	"log"
 	"net/http"
+	"os"
+	"strings"
 	"time"
 
 	"github.com/3elDU/rss-reader-backend/database"
 	"github.com/3elDU/rss-reader-backend/middleware"
+	"github.com/3elDU/rss-reader-backend/oidc"
 	"github.com/3elDU/rss-reader-backend/refresh"
+	"github.com/3elDU/rss-reader-backend/resource"
 	"github.com/3elDU/rss-reader-backend/server"
 	"github.com/3elDU/rss-reader-backend/token"
 	"github.com/jmoiron/sqlx"
@@ -21,6 +30,66 @@ var (
 		false,
 		"Create a new authentication token, output it and exit.",
 	)
+	userName = flag.String(
+		"user",
+		"default",
+		"Used with 'createtoken', 'setpassword', 'importopml' and 'exportopml'. Name of the user to act on behalf of. The user is created if it doesn't exist.",
+	)
+	tokenLabel = flag.String(
+		"label",
+		"",
+		"Used with 'createtoken'. Human readable name of the token.",
+	)
+	tokenScopes = flag.String(
+		"scopes",
+		"read,write,admin",
+		"Used with 'createtoken'. Comma-separated permissions of the token: 'read', 'write' and 'admin'.",
+	)
+	setPassword = flag.Bool(
+		"setpassword",
+		false,
+		"Read the password of the user from the first line of the standard input, set it and exit. The user can then obtain tokens with POST /auth/login.",
+	)
+	loginValidFor = flag.Duration(
+		"loginvalidfor",
+		server.DefaultLoginValidFor,
+		"Maximum and default duration for which the tokens issued by POST /auth/login are valid.",
+	)
+	oidcIssuer = flag.String(
+		"oidcissuer",
+		"",
+		"URL of the OpenID Connect provider to log in with, at GET /auth/oidc/login. Empty disables the login.",
+	)
+	oidcClientID = flag.String(
+		"oidcclientid",
+		"",
+		"Used with 'oidcissuer'. Id of the client registered at the provider.",
+	)
+	oidcClientSecret = flag.String(
+		"oidcclientsecret",
+		"",
+		"Used with 'oidcissuer'. Secret of the client registered at the provider. Can be empty for public clients.",
+	)
+	oidcRedirectURL = flag.String(
+		"oidcredirect",
+		"",
+		"Used with 'oidcissuer'. Public URL of GET /auth/oidc/callback, which must be registered at the provider.",
+	)
+	oidcScopes = flag.String(
+		"oidcscopes",
+		"profile,email",
+		"Used with 'oidcissuer'. Comma-separated scopes requested in addition to 'openid'. The username and email name the new users.",
+	)
+	listTokens = flag.Bool(
+		"listtokens",
+		false,
+		"List authentication tokens of all users, without the tokens themselves, and exit.",
+	)
+	revokeToken = flag.Int64(
+		"revoketoken",
+		0,
+		"Delete the authentication token with the given id and exit.",
+	)
 	listenAddr = flag.String(
 		"listen",
 		"[::1]:8080",
@@ -36,10 +105,40 @@ var (
 		time.Duration(0),
 		"Used with 'createToken'. The duration for which the token will be valid. The default is no expiration.",
 	)
+	idleTimeout = flag.Duration(
+		"idletimeout",
+		time.Duration(0),
+		"Used with 'createToken'. The token expires after being unused for this long, instead of after 'validfor'.",
+	)
+	importOPML = flag.String(
+		"importopml",
+		"",
+		"Subscribe to all feeds from the given OPML file, print the report and exit.",
+	)
+	exportOPML = flag.String(
+		"exportopml",
+		"",
+		"Write all subscriptions to the given file in OPML format and exit.",
+	)
 	refreshFreq = flag.Duration(
 		"refresh",
-		time.Minute*15,
-		"Frequency with which feeds will be updated",
+		refresh.DefaultSchedule.MinInterval,
+		"Minimum interval between refreshes of a single feed. Each feed is refreshed according to how often it publishes articles.",
+	)
+	maxRefresh = flag.Duration(
+		"maxrefresh",
+		refresh.DefaultSchedule.MaxInterval,
+		"Maximum interval between refreshes of a single feed, unless the feed asks for a longer one.",
+	)
+	refreshWorkers = flag.Int(
+		"refreshworkers",
+		refresh.DefaultWorkers,
+		"Number of feeds that are fetched at the same time during the refresh.",
+	)
+	feedTimeout = flag.Duration(
+		"feedtimeout",
+		refresh.DefaultTimeout,
+		"Maximum time that fetching a single feed can take during the refresh.",
 	)
 )
 
@@ -55,7 +154,10 @@ func main() {
 	)
 
 	flag.Parse()
-	if middleware.NoAuth && !*createToken {
+	// Whether the program will run a single command and exit, without starting the server
+	oneShot := *createToken || *setPassword || *listTokens || *revokeToken != 0 || *importOPML != "" || *exportOPML != ""
+
+	if middleware.NoAuth && !oneShot {
 		log.Printf("*** RUNNING WITH AUTHENTICATION DISABLED ***")
 	}
 
@@ -66,31 +168,248 @@ func main() {
 
 	// Instantiate the database
 	db := sqlx.NewDb(dbOrig, "sqlite")
-	if !*createToken {
+	if !oneShot {
 		log.Printf("Connected to the database in '%v'", *databasePath)
 	}
 	defer db.Close()
 
 	if *createToken {
-		t := token.New(validFor).ToModel()
+		userId, err := findOrCreateUser(db, *userName)
+		if err != nil {
+			log.Fatalf("failed to find the user: %v", err)
+		}
+
+		scopes, err := token.ParseScopes(strings.Split(*tokenScopes, ","))
+		if err != nil {
+			log.Fatalf("invalid scopes: %v", err)
+		}
+
+		tok := token.New(validFor)
+		tok.UserId = userId
+		tok.Label = *tokenLabel
+		tok.Scopes = scopes
+		if *idleTimeout != 0 {
+			if *idleTimeout < token.MinIdleTimeout {
+				log.Fatalf("idle timeout must be at least %v", token.MinIdleTimeout)
+			}
+			tok.SetIdleTimeout(*idleTimeout)
+		}
+		t := tok.ToModel()
 		repo := database.NewTokenRepository(db)
 		if err := repo.Insert(&t); err != nil {
 			panic(err)
 		}
-		fmt.Println(t.Token)
+		// This is the only time the token is shown, only its digest is stored
+		fmt.Println(tok.Token)
+
+		return
+	}
+
+	if *setPassword {
+		if err := runSetPassword(db); err != nil {
+			log.Fatalf("failed to set the password: %v", err)
+		}
+
+		return
+	}
+
+	if *listTokens {
+		if err := runListTokens(db); err != nil {
+			log.Fatalf("failed to list tokens: %v", err)
+		}
+
+		return
+	}
+
+	if *revokeToken != 0 {
+		if err := database.NewTokenRepository(db).DeleteById(*revokeToken); err != nil {
+			log.Fatalf("failed to revoke token %v: %v", *revokeToken, err)
+		}
+
+		return
+	}
+
+	if *importOPML != "" {
+		if err := runImport(db, *importOPML); err != nil {
+			log.Fatalf("opml import failed: %v", err)
+		}
+
+		return
+	}
+
+	if *exportOPML != "" {
+		if err := runExport(db, *exportOPML); err != nil {
+			log.Fatalf("opml export failed: %v", err)
+		}
 
 		return
 	}
 
 	log.Printf("Running the web server on %v", *listenAddr)
 
-	task := refresh.NewTask(db, *refreshFreq)
+	schedule := refresh.DefaultSchedule
+	schedule.MinInterval = *refreshFreq
+	schedule.MaxInterval = max(*maxRefresh, *refreshFreq)
+	schedule.MaxBackoff = max(schedule.MaxBackoff, schedule.MaxInterval)
+
+	task := refresh.NewTask(db, schedule)
+	task.Workers = *refreshWorkers
+	task.Timeout = *feedTimeout
 	server := server.NewServer(db, task)
+	server.LoginValidFor = *loginValidFor
+	go server.Usage.Run(token.DefaultFlushInterval)
+
+	if *oidcIssuer != "" {
+		provider, err := discoverOIDC()
+		if err != nil {
+			log.Fatalf("failed to set up the OpenID Connect login: %v", err)
+		}
+		server.EnableOIDC(provider)
+		log.Printf("Logging in with OpenID Connect through %v", provider.Metadata.Issuer)
+	}
 
 	go runServer(server)
 	task.Run()
 }
 
+func runListTokens(db *sqlx.DB) error {
+	tms, err := database.NewTokenRepository(db).All()
+	if err != nil {
+		return err
+	}
+
+	for _, tm := range tms {
+		t := resource.NewToken(token.FromModel(tm))
+		validUntil := t.ValidUntil
+		if validUntil == "" {
+			validUntil = "never"
+		}
+		lastUsed := t.LastUsedAt
+		if lastUsed == "" {
+			lastUsed = "never"
+		}
+		fmt.Printf("%v\t%v\t%v\t%v\t%v\t%v\t%v\n", t.Id, tm.UserId, t.CreatedAt, validUntil, lastUsed, tm.Scopes, t.Label)
+	}
+
+	return nil
+}
+
+func runSetPassword(db *sqlx.DB) error {
+	userId, err := findOrCreateUser(db, *userName)
+	if err != nil {
+		return err
+	}
+
+	password, err := bufio.NewReader(os.Stdin).ReadString('\n')
+	if err != nil && !errors.Is(err, io.EOF) {
+		return err
+	}
+	password = strings.TrimRight(password, "\r\n")
+	if password == "" {
+		return errors.New("the password is empty")
+	}
+
+	repo := database.NewUserRepository(db)
+	u, err := repo.Find(userId)
+	if err != nil {
+		return err
+	}
+
+	return repo.SetPassword(u, password)
+}
+
+func runImport(db *sqlx.DB, path string) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	userId, err := findOrCreateUser(db, *userName)
+	if err != nil {
+		return err
+	}
+
+	res, err := server.NewServer(db, nil).ImportOPML(userId, f)
+	if err != nil {
+		return err
+	}
+
+	for _, r := range res {
+		if r.Error != "" {
+			fmt.Printf("%v\t%v\t%v\n", r.Status, r.Url, r.Error)
+		} else {
+			fmt.Printf("%v\t%v\n", r.Status, r.Url)
+		}
+	}
+
+	return nil
+}
+
+func runExport(db *sqlx.DB, path string) error {
+	userId, err := findOrCreateUser(db, *userName)
+	if err != nil {
+		return err
+	}
+
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+
+	if err := server.NewServer(db, nil).ExportOPML(userId, f); err != nil {
+		f.Close()
+		return err
+	}
+
+	return f.Close()
+}
+
+// findOrCreateUser returns the id of the user with the given name, creating the user if it doesn't exist yet.
+func findOrCreateUser(db *sqlx.DB, name string) (int64, error) {
+	repo := database.NewUserRepository(db)
+
+	u, err := repo.FindByName(name)
+	if err == nil {
+		return u.ID, nil
+	} else if !errors.Is(err, sql.ErrNoRows) {
+		return 0, err
+	}
+
+	u = &database.User{Name: name}
+	if err := repo.Insert(u); err != nil {
+		return 0, err
+	}
+	log.Printf("Created user '%v'", name)
+
+	return u.ID, nil
+}
+
+// discoverOIDC fetches the configuration of the OpenID Connect provider given by the flags
+func discoverOIDC() (*oidc.Provider, error) {
+	if *oidcClientID == "" || *oidcRedirectURL == "" {
+		return nil, errors.New("'oidcclientid' and 'oidcredirect' are required")
+	}
+
+	scopes := []string{}
+	for _, s := range strings.Split(*oidcScopes, ",") {
+		if s = strings.TrimSpace(s); s != "" {
+			scopes = append(scopes, s)
+		}
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	return oidc.Discover(ctx, oidc.Config{
+		Issuer:       *oidcIssuer,
+		ClientID:     *oidcClientID,
+		ClientSecret: *oidcClientSecret,
+		RedirectURL:  *oidcRedirectURL,
+		Scopes:       scopes,
+	}, nil)
+}
+
 func runServer(server *server.Server) {
 	err := http.ListenAndServe(*listenAddr, server)
 	if err != nil {
@@ -3,7 +3,9 @@ package middleware
 import (
 	"context"
 	"database/sql"
+	"encoding/json"
 	"errors"
+	"fmt"
 	"log"
 	"net/http"
 	"strings"
@@ -18,10 +20,11 @@ var (
 	NoAuth = false
 )
 
-// Auth checks the token in the Authorization header against the provided database.
-// The token is then provided in the context value
-// If `NoAuth` is false - all checks are skipped and the dummy token is set in the context
-func Auth(repo database.TokenRepository, next http.HandlerFunc) http.HandlerFunc {
+// Auth checks the token in the Authorization header against the provided database,
+// and responds with 403 if the token doesn't carry the scope. An empty scope only requires a valid token.
+// The token is then provided in the context value, and its use is recorded by the tracker, unless it's nil.
+// If `NoAuth` is true - all checks are skipped and the dummy token of the default user is set in the context
+func Auth(repo database.TokenRepository, usage *token.UsageTracker, scope token.Scope, next http.HandlerFunc) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		if NoAuth {
 			request := r.WithContext(context.WithValue(
@@ -29,8 +32,10 @@ func Auth(repo database.TokenRepository, next http.HandlerFunc) http.HandlerFunc
 				token.TokenContextKey,
 				token.Token{
 					ID:        0,
+					UserId:    database.DefaultUserId,
 					Token:     "dummy",
 					CreatedAt: time.Now(),
+					Scopes:    token.AllScopes,
 				},
 			))
 			next(w, request)
@@ -44,7 +49,9 @@ func Auth(repo database.TokenRepository, next http.HandlerFunc) http.HandlerFunc
 			return
 		}
 
-		tm, err := repo.Find(tokenStr)
+		// Only digests of the tokens are stored, so the digest is looked up.
+		// Timing of the lookup can only leak the digest, which doesn't help to guess the token.
+		tm, err := repo.FindByHash(database.HashToken(tokenStr))
 		if errors.Is(err, sql.ErrNoRows) {
 			w.WriteHeader(http.StatusUnauthorized)
 			return
@@ -57,13 +64,41 @@ func Auth(repo database.TokenRepository, next http.HandlerFunc) http.HandlerFunc
 		t := token.FromModel(*tm)
 
 		// Check if the token is still valid
+		// Expired tokens are deleted, and the client is told why the token stopped working
 		if t.Expired() {
-			log.Printf("authentication: token expired on %v", t.ValidUntil)
-			repo.Delete(*tm)
+			log.Printf("authentication: token %v of user %v expired on %v, deleting it", t.ID, t.UserId, t.ValidUntil)
+			if err := repo.Delete(*tm); err != nil {
+				log.Printf("authentication: failed to delete expired token %v: %v", t.ID, err)
+			}
+
+			res, _ := json.Marshal(ServerError{
+				Error:   true,
+				Message: fmt.Sprintf("token expired on %v", t.ValidUntil.Format(time.DateTime)),
+			})
+			w.Header().Set("WWW-Authenticate", `Bearer error="invalid_token", error_description="token expired"`)
+			w.Header().Set("Content-Type", "application/json; charset=utf-8")
 			w.WriteHeader(http.StatusUnauthorized)
+			w.Write(res)
 			return
 		}
 
+		if scope != "" && !t.HasScope(scope) {
+			log.Printf("authentication: token %v is missing the '%v' scope", t.ID, scope)
+
+			res, _ := json.Marshal(ServerError{
+				Error:   true,
+				Message: fmt.Sprintf("token is missing the '%v' scope", scope),
+			})
+			w.Header().Set("Content-Type", "application/json; charset=utf-8")
+			w.WriteHeader(http.StatusForbidden)
+			w.Write(res)
+			return
+		}
+
+		if usage != nil {
+			usage.Record(t, r)
+		}
+
 		request := r.WithContext(context.WithValue(
 			r.Context(),
 			token.TokenContextKey,
@@ -0,0 +1,159 @@
+// oidc package implements the OpenID Connect authorization code flow with PKCE, for logging in through an identity provider
+
+package oidc
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+)
+
+type Config struct {
+	// URL of the identity provider, without the /.well-known/openid-configuration suffix
+	Issuer       string
+	ClientID     string
+	ClientSecret string
+	// Where the provider sends the user back to after the login, the callback route of the server
+	RedirectURL string
+	// Scopes requested in addition to "openid", like "email" or "profile"
+	Scopes []string
+}
+
+// Metadata is the part of the provider configuration that is used by the flow
+type Metadata struct {
+	Issuer                string `json:"issuer"`
+	AuthorizationEndpoint string `json:"authorization_endpoint"`
+	TokenEndpoint         string `json:"token_endpoint"`
+	JWKSURI               string `json:"jwks_uri"`
+}
+
+type Provider struct {
+	Config
+	Metadata
+
+	client *http.Client
+
+	mu sync.Mutex
+	// Signing keys of the provider by their id, see keySet
+	keys keySet
+	// When the keys were fetched last time, so that unknown key ids don't make them refetched on every request
+	keysFetchedAt time.Time
+}
+
+// Discover fetches the configuration of the provider, and checks that it belongs to the configured issuer.
+// If client is nil, http.DefaultClient is used.
+func Discover(ctx context.Context, cfg Config, client *http.Client) (*Provider, error) {
+	if client == nil {
+		client = http.DefaultClient
+	}
+
+	p := &Provider{Config: cfg, client: client}
+
+	wellKnown := strings.TrimSuffix(cfg.Issuer, "/") + "/.well-known/openid-configuration"
+	if err := p.getJSON(ctx, wellKnown, &p.Metadata); err != nil {
+		return nil, fmt.Errorf("discovery: %w", err)
+	}
+
+	// Otherwise a compromised document could make the tokens of another issuer accepted
+	if p.Metadata.Issuer != cfg.Issuer {
+		return nil, fmt.Errorf("discovery: issuer is '%v', expected '%v'", p.Metadata.Issuer, cfg.Issuer)
+	}
+	if p.AuthorizationEndpoint == "" || p.TokenEndpoint == "" || p.JWKSURI == "" {
+		return nil, errors.New("discovery: provider configuration is missing endpoints")
+	}
+
+	return p, nil
+}
+
+// AuthURL returns the URL the user is sent to for the login.
+// The state and the nonce are checked on the way back, and the challenge is derived from the verifier passed to Exchange.
+func (p *Provider) AuthURL(state, nonce, challenge string) string {
+	q := url.Values{
+		"response_type":         {"code"},
+		"client_id":             {p.ClientID},
+		"redirect_uri":          {p.RedirectURL},
+		"scope":                 {strings.Join(append([]string{"openid"}, p.Scopes...), " ")},
+		"state":                 {state},
+		"nonce":                 {nonce},
+		"code_challenge":        {challenge},
+		"code_challenge_method": {"S256"},
+	}
+
+	sep := "?"
+	if strings.Contains(p.AuthorizationEndpoint, "?") {
+		sep = "&"
+	}
+	return p.AuthorizationEndpoint + sep + q.Encode()
+}
+
+// Exchange trades the authorization code for the ID token of the user, which still has to be checked with Verify.
+func (p *Provider) Exchange(ctx context.Context, code, verifier string) (string, error) {
+	form := url.Values{
+		"grant_type":    {"authorization_code"},
+		"code":          {code},
+		"redirect_uri":  {p.RedirectURL},
+		"client_id":     {p.ClientID},
+		"code_verifier": {verifier},
+	}
+
+	req, err := http.NewRequestWithContext(ctx, "POST", p.TokenEndpoint, strings.NewReader(form.Encode()))
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("Accept", "application/json")
+	if p.ClientSecret != "" {
+		req.SetBasicAuth(url.QueryEscape(p.ClientID), url.QueryEscape(p.ClientSecret))
+	}
+
+	res, err := p.client.Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer res.Body.Close()
+
+	body := struct {
+		IDToken          string `json:"id_token"`
+		Error            string `json:"error"`
+		ErrorDescription string `json:"error_description"`
+	}{}
+	if err := json.NewDecoder(io.LimitReader(res.Body, 1<<20)).Decode(&body); err != nil {
+		return "", fmt.Errorf("token endpoint responded with %v: %w", res.Status, err)
+	}
+
+	if res.StatusCode != http.StatusOK || body.Error != "" {
+		return "", fmt.Errorf("token endpoint responded with %v: %v %v", res.Status, body.Error, body.ErrorDescription)
+	}
+	if body.IDToken == "" {
+		return "", errors.New("token endpoint didn't return an id token")
+	}
+
+	return body.IDToken, nil
+}
+
+func (p *Provider) getJSON(ctx context.Context, url string, v any) error {
+	req, err := http.NewRequestWithContext(ctx, "GET", url, nil)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Accept", "application/json")
+
+	res, err := p.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode != http.StatusOK {
+		return fmt.Errorf("%v responded with %v", url, res.Status)
+	}
+
+	return json.NewDecoder(io.LimitReader(res.Body, 1<<20)).Decode(v)
+}
@@ -0,0 +1,149 @@
+package oidc_test
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"errors"
+	"net/http"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/3elDU/rss-reader-backend/oidc"
+	"github.com/3elDU/rss-reader-backend/oidc/oidctest"
+)
+
+const clientId = "rss-reader"
+
+func discover(t *testing.T, fake *oidctest.Provider) *oidc.Provider {
+	t.Helper()
+
+	p, err := oidc.Discover(context.Background(), oidc.Config{
+		Issuer:      fake.Issuer(),
+		ClientID:    clientId,
+		RedirectURL: "https://reader.example.com/auth/oidc/callback",
+	}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return p
+}
+
+func TestDiscoverChecksIssuer(t *testing.T) {
+	fake := oidctest.NewProvider(clientId)
+	defer fake.Close()
+
+	_, err := oidc.Discover(context.Background(), oidc.Config{Issuer: fake.Issuer() + "/other"}, nil)
+	if err == nil {
+		t.Error("discovery should fail for another issuer")
+	}
+}
+
+func TestVerify(t *testing.T) {
+	fake := oidctest.NewProvider(clientId)
+	defer fake.Close()
+	p := discover(t, fake)
+
+	otherKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// claims returns valid claims with the given ones changed
+	claims := func(changed map[string]any) map[string]any {
+		c := fake.Claims("1234", "nonce")
+		for k, v := range changed {
+			c[k] = v
+		}
+		return c
+	}
+
+	tests := []struct {
+		name  string
+		token string
+		valid bool
+	}{
+		{"valid", fake.Sign(claims(nil)), true},
+		{"audience array", fake.Sign(claims(map[string]any{"aud": []string{clientId}})), true},
+		{"signed with another key", fake.SignWith(otherKey, oidctest.KeyID, claims(nil)), false},
+		{"unknown key", fake.SignWith(otherKey, "other", claims(nil)), false},
+		{"another issuer", fake.Sign(claims(map[string]any{"iss": "https://evil.example.com"})), false},
+		{"another client", fake.Sign(claims(map[string]any{"aud": "other"})), false},
+		{"several audiences without azp", fake.Sign(claims(map[string]any{"aud": []string{clientId, "other"}})), false},
+		{"expired", fake.Sign(claims(map[string]any{"exp": time.Now().Add(-time.Hour).Unix()})), false},
+		{"wrong nonce", fake.Sign(claims(map[string]any{"nonce": "replayed"})), false},
+		{"missing subject", fake.Sign(claims(map[string]any{"sub": ""})), false},
+		{"malformed", "not.a.token", false},
+		{"unsigned", "eyJhbGciOiJub25lIn0.eyJzdWIiOiIxMjM0In0.", false},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			c, err := p.Verify(context.Background(), test.token, "nonce")
+			if test.valid && err != nil {
+				t.Errorf("token should be valid: %v", err)
+			} else if !test.valid && !errors.Is(err, oidc.ErrInvalidToken) {
+				t.Errorf("token should be invalid, got %+v %v", c, err)
+			}
+			if test.valid && c.Subject != "1234" {
+				t.Errorf("unexpected subject: %v", c.Subject)
+			}
+		})
+	}
+}
+
+func TestAuthorizationCodeFlow(t *testing.T) {
+	fake := oidctest.NewProvider(clientId)
+	defer fake.Close()
+	p := discover(t, fake)
+
+	// authorize visits the login URL like the browser would, and returns the code the provider redirects back with
+	authorize := func(state, nonce, verifier string) string {
+		t.Helper()
+
+		client := &http.Client{
+			CheckRedirect: func(*http.Request, []*http.Request) error {
+				return http.ErrUseLastResponse
+			},
+		}
+		res, err := client.Get(p.AuthURL(state, nonce, oidc.Challenge(verifier)))
+		if err != nil {
+			t.Fatal(err)
+		}
+		res.Body.Close()
+
+		loc, err := url.Parse(res.Header.Get("Location"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if loc.Query().Get("state") != state {
+			t.Errorf("state was not passed back: %v", loc)
+		}
+		return loc.Query().Get("code")
+	}
+
+	verifier := oidc.RandomString()
+	code := authorize("state", "nonce", verifier)
+
+	raw, err := p.Exchange(context.Background(), code, verifier)
+	if err != nil {
+		t.Fatal(err)
+	}
+	c, err := p.Verify(context.Background(), raw, "nonce")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if c.Subject != fake.Subject {
+		t.Errorf("unexpected subject: want %v, got %v", fake.Subject, c.Subject)
+	}
+
+	if _, err := p.Exchange(context.Background(), code, verifier); err == nil {
+		t.Error("code should not be exchanged twice")
+	}
+
+	code = authorize("state", "nonce", verifier)
+	if _, err := p.Exchange(context.Background(), code, oidc.RandomString()); err == nil {
+		t.Error("code should not be exchanged without the right verifier")
+	}
+}
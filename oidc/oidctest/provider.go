@@ -0,0 +1,191 @@
+// oidctest package provides an in-process OpenID Connect provider for tests
+
+package oidctest
+
+import (
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sync"
+	"time"
+
+	"github.com/3elDU/rss-reader-backend/oidc"
+)
+
+const KeyID = "test-key"
+
+// Provider is an identity provider that logs in whoever visits the authorization endpoint as Subject.
+// It checks the client id, the redirect URL and the PKCE verifier the way a real provider does.
+type Provider struct {
+	*httptest.Server
+	ClientID string
+	// The user that logs in, and their optional username
+	Subject           string
+	PreferredUsername string
+
+	key *rsa.PrivateKey
+
+	mu sync.Mutex
+	// Issued authorization codes, each can be exchanged once
+	codes map[string]grant
+}
+
+type grant struct {
+	redirectURL string
+	challenge   string
+	nonce       string
+	subject     string
+	username    string
+}
+
+// NewProvider starts the provider. It's closed with Close.
+func NewProvider(clientID string) *Provider {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		panic(err)
+	}
+
+	p := &Provider{
+		ClientID: clientID,
+		Subject:  "1234",
+		key:      key,
+		codes:    map[string]grant{},
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /.well-known/openid-configuration", p.discovery)
+	mux.HandleFunc("GET /keys", p.keys)
+	mux.HandleFunc("GET /authorize", p.authorize)
+	mux.HandleFunc("POST /token", p.token)
+	p.Server = httptest.NewServer(mux)
+
+	return p
+}
+
+// Issuer is the issuer the provider is configured with
+func (p *Provider) Issuer() string {
+	return p.URL
+}
+
+// Sign signs the claims with the key of the provider, making an ID token
+func (p *Provider) Sign(claims map[string]any) string {
+	return p.SignWith(p.key, KeyID, claims)
+}
+
+// SignWith signs the claims with another key, for making tokens that the provider didn't issue
+func (p *Provider) SignWith(key *rsa.PrivateKey, kid string, claims map[string]any) string {
+	header, _ := json.Marshal(map[string]string{"alg": "RS256", "typ": "JWT", "kid": kid})
+	payload, _ := json.Marshal(claims)
+
+	signed := base64.RawURLEncoding.EncodeToString(header) + "." + base64.RawURLEncoding.EncodeToString(payload)
+	digest := sha256.Sum256([]byte(signed))
+	sig, err := rsa.SignPKCS1v15(rand.Reader, key, crypto.SHA256, digest[:])
+	if err != nil {
+		panic(err)
+	}
+
+	return signed + "." + base64.RawURLEncoding.EncodeToString(sig)
+}
+
+// Claims returns valid claims of an ID token for the subject, which can be changed before signing
+func (p *Provider) Claims(subject, nonce string) map[string]any {
+	now := time.Now()
+	return map[string]any{
+		"iss":   p.Issuer(),
+		"sub":   subject,
+		"aud":   p.ClientID,
+		"iat":   now.Unix(),
+		"exp":   now.Add(time.Hour).Unix(),
+		"nonce": nonce,
+	}
+}
+
+func (p *Provider) discovery(w http.ResponseWriter, r *http.Request) {
+	json.NewEncoder(w).Encode(oidc.Metadata{
+		Issuer:                p.Issuer(),
+		AuthorizationEndpoint: p.URL + "/authorize",
+		TokenEndpoint:         p.URL + "/token",
+		JWKSURI:               p.URL + "/keys",
+	})
+}
+
+func (p *Provider) keys(w http.ResponseWriter, r *http.Request) {
+	pub := p.key.PublicKey
+	json.NewEncoder(w).Encode(map[string]any{
+		"keys": []map[string]string{{
+			"kty": "RSA",
+			"use": "sig",
+			"alg": "RS256",
+			"kid": KeyID,
+			"n":   base64.RawURLEncoding.EncodeToString(pub.N.Bytes()),
+			"e":   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(pub.E)).Bytes()),
+		}},
+	})
+}
+
+// authorize logs the user in right away, and sends them back to the client with a code
+func (p *Provider) authorize(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	if q.Get("client_id") != p.ClientID || q.Get("response_type") != "code" || q.Get("code_challenge_method") != "S256" || q.Get("code_challenge") == "" {
+		http.Error(w, "invalid authorization request", http.StatusBadRequest)
+		return
+	}
+
+	code := oidc.RandomString()
+	p.mu.Lock()
+	p.codes[code] = grant{
+		redirectURL: q.Get("redirect_uri"),
+		challenge:   q.Get("code_challenge"),
+		nonce:       q.Get("nonce"),
+		subject:     p.Subject,
+		username:    p.PreferredUsername,
+	}
+	p.mu.Unlock()
+
+	redirect, err := url.Parse(q.Get("redirect_uri"))
+	if err != nil {
+		http.Error(w, "invalid redirect_uri", http.StatusBadRequest)
+		return
+	}
+	rq := redirect.Query()
+	rq.Set("code", code)
+	rq.Set("state", q.Get("state"))
+	redirect.RawQuery = rq.Encode()
+
+	http.Redirect(w, r, redirect.String(), http.StatusFound)
+}
+
+func (p *Provider) token(w http.ResponseWriter, r *http.Request) {
+	code := r.PostFormValue("code")
+
+	p.mu.Lock()
+	g, ok := p.codes[code]
+	delete(p.codes, code)
+	p.mu.Unlock()
+
+	w.Header().Set("Content-Type", "application/json")
+	if !ok || r.PostFormValue("client_id") != p.ClientID || r.PostFormValue("redirect_uri") != g.redirectURL ||
+		oidc.Challenge(r.PostFormValue("code_verifier")) != g.challenge {
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(map[string]string{"error": "invalid_grant"})
+		return
+	}
+
+	claims := p.Claims(g.subject, g.nonce)
+	if g.username != "" {
+		claims["preferred_username"] = g.username
+	}
+
+	json.NewEncoder(w).Encode(map[string]string{
+		"access_token": oidc.RandomString(),
+		"token_type":   "Bearer",
+		"id_token":     p.Sign(claims),
+	})
+}
@@ -0,0 +1,214 @@
+package oidc
+
+import (
+	"context"
+	"crypto"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+	"slices"
+	"strings"
+	"time"
+)
+
+const (
+	// Allowed difference between the clocks of the provider and the server
+	clockSkew = time.Minute
+	// Keys are refetched for an unknown key id at most this often
+	keysRefetchInterval = time.Minute
+)
+
+var ErrInvalidToken = errors.New("invalid id token")
+
+// Claims of the ID token that identify the user
+type Claims struct {
+	Issuer   string   `json:"iss"`
+	Subject  string   `json:"sub"`
+	Audience audience `json:"aud"`
+	// Authorized party, the client the token was issued to when there are several audiences
+	AuthorizedParty string `json:"azp"`
+	Expiry          int64  `json:"exp"`
+	IssuedAt        int64  `json:"iat"`
+	Nonce           string `json:"nonce"`
+
+	// Optional, depending on the requested scopes
+	PreferredUsername string `json:"preferred_username"`
+	Email             string `json:"email"`
+}
+
+// audience is either a single string or an array of them
+type audience []string
+
+func (a *audience) UnmarshalJSON(b []byte) error {
+	var single string
+	if err := json.Unmarshal(b, &single); err == nil {
+		*a = audience{single}
+		return nil
+	}
+
+	var many []string
+	if err := json.Unmarshal(b, &many); err != nil {
+		return err
+	}
+	*a = many
+	return nil
+}
+
+// keySet maps key ids to the RSA keys of the provider
+type keySet map[string]*rsa.PublicKey
+
+// Verify checks the RS256 signature of the ID token against the keys of the provider, and that it was issued
+// by the provider to this client, hasn't expired, and carries the nonce sent with the login.
+func (p *Provider) Verify(ctx context.Context, raw, nonce string) (*Claims, error) {
+	parts := strings.Split(raw, ".")
+	if len(parts) != 3 {
+		return nil, fmt.Errorf("%w: malformed token", ErrInvalidToken)
+	}
+
+	header := struct {
+		Alg string `json:"alg"`
+		Kid string `json:"kid"`
+	}{}
+	if err := decodeSegment(parts[0], &header); err != nil {
+		return nil, fmt.Errorf("%w: malformed header: %v", ErrInvalidToken, err)
+	}
+	// Only the algorithm that every provider has to support, which also rules out "none"
+	if header.Alg != "RS256" {
+		return nil, fmt.Errorf("%w: unsupported algorithm '%v'", ErrInvalidToken, header.Alg)
+	}
+
+	sig, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil {
+		return nil, fmt.Errorf("%w: malformed signature", ErrInvalidToken)
+	}
+
+	key, err := p.key(ctx, header.Kid)
+	if err != nil {
+		return nil, err
+	}
+
+	digest := sha256.Sum256([]byte(parts[0] + "." + parts[1]))
+	if err := rsa.VerifyPKCS1v15(key, crypto.SHA256, digest[:], sig); err != nil {
+		return nil, fmt.Errorf("%w: bad signature", ErrInvalidToken)
+	}
+
+	c := &Claims{}
+	if err := decodeSegment(parts[1], c); err != nil {
+		return nil, fmt.Errorf("%w: malformed claims: %v", ErrInvalidToken, err)
+	}
+
+	now := time.Now()
+	switch {
+	case c.Issuer != p.Metadata.Issuer:
+		return nil, fmt.Errorf("%w: issued by '%v'", ErrInvalidToken, c.Issuer)
+	case !slices.Contains(c.Audience, p.ClientID):
+		return nil, fmt.Errorf("%w: issued for another client", ErrInvalidToken)
+	case len(c.Audience) > 1 && c.AuthorizedParty != p.ClientID:
+		return nil, fmt.Errorf("%w: issued for another client", ErrInvalidToken)
+	case c.Subject == "":
+		return nil, fmt.Errorf("%w: missing subject", ErrInvalidToken)
+	case now.After(time.Unix(c.Expiry, 0).Add(clockSkew)):
+		return nil, fmt.Errorf("%w: expired", ErrInvalidToken)
+	case now.Add(clockSkew).Before(time.Unix(c.IssuedAt, 0)):
+		return nil, fmt.Errorf("%w: issued in the future", ErrInvalidToken)
+	case c.Nonce != nonce:
+		return nil, fmt.Errorf("%w: nonce mismatch", ErrInvalidToken)
+	}
+
+	return c, nil
+}
+
+// key returns the signing key with the given id. The keys are refetched when the id is unknown, since providers rotate them.
+func (p *Provider) key(ctx context.Context, kid string) (*rsa.PublicKey, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if key, ok := p.keys.find(kid); ok {
+		return key, nil
+	}
+
+	if time.Since(p.keysFetchedAt) < keysRefetchInterval {
+		return nil, fmt.Errorf("%w: unknown key '%v'", ErrInvalidToken, kid)
+	}
+
+	keys, err := p.fetchKeys(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch the keys of the provider: %w", err)
+	}
+	p.keys = keys
+	p.keysFetchedAt = time.Now()
+
+	if key, ok := p.keys.find(kid); ok {
+		return key, nil
+	}
+	return nil, fmt.Errorf("%w: unknown key '%v'", ErrInvalidToken, kid)
+}
+
+// find looks the key up by its id. Tokens without a key id can only be checked when the provider has a single key.
+func (s keySet) find(kid string) (*rsa.PublicKey, bool) {
+	if kid == "" && len(s) == 1 {
+		for _, key := range s {
+			return key, true
+		}
+	}
+
+	key, ok := s[kid]
+	return key, ok
+}
+
+// fetchKeys downloads the JSON Web Key Set of the provider, keeping only the RSA signing keys
+func (p *Provider) fetchKeys(ctx context.Context) (keySet, error) {
+	jwks := struct {
+		Keys []struct {
+			Kty string `json:"kty"`
+			Kid string `json:"kid"`
+			Use string `json:"use"`
+			N   string `json:"n"`
+			E   string `json:"e"`
+		} `json:"keys"`
+	}{}
+	if err := p.getJSON(ctx, p.JWKSURI, &jwks); err != nil {
+		return nil, err
+	}
+
+	keys := keySet{}
+	for _, k := range jwks.Keys {
+		if k.Kty != "RSA" || (k.Use != "" && k.Use != "sig") {
+			continue
+		}
+
+		n, err := base64.RawURLEncoding.DecodeString(k.N)
+		if err != nil {
+			return nil, fmt.Errorf("malformed key '%v': %w", k.Kid, err)
+		}
+		e, err := base64.RawURLEncoding.DecodeString(k.E)
+		if err != nil {
+			return nil, fmt.Errorf("malformed key '%v': %w", k.Kid, err)
+		}
+
+		exp := new(big.Int).SetBytes(e)
+		if !exp.IsInt64() || exp.Int64() < 3 || exp.Int64() > 1<<31-1 {
+			return nil, fmt.Errorf("malformed key '%v': bad exponent", k.Kid)
+		}
+
+		keys[k.Kid] = &rsa.PublicKey{
+			N: new(big.Int).SetBytes(n),
+			E: int(exp.Int64()),
+		}
+	}
+
+	return keys, nil
+}
+
+func decodeSegment(seg string, v any) error {
+	b, err := base64.RawURLEncoding.DecodeString(seg)
+	if err != nil {
+		return err
+	}
+
+	return json.Unmarshal(b, v)
+}
@@ -0,0 +1,106 @@
+// opml package reads and writes OPML documents, which are used by feed readers to exchange subscription lists
+
+package opml
+
+import (
+	"encoding/xml"
+	"fmt"
+	"io"
+	"strings"
+
+	"golang.org/x/net/html/charset"
+)
+
+type Document struct {
+	XMLName xml.Name `xml:"opml"`
+	Version string   `xml:"version,attr"`
+	Head    Head     `xml:"head"`
+	Body    Body     `xml:"body"`
+}
+
+type Head struct {
+	Title       string `xml:"title,omitempty"`
+	DateCreated string `xml:"dateCreated,omitempty"`
+}
+
+type Body struct {
+	Outlines []Outline `xml:"outline"`
+}
+
+// Outline is either a feed, when XMLURL is set, or a group of nested outlines.
+type Outline struct {
+	Text        string    `xml:"text,attr"`
+	Title       string    `xml:"title,attr,omitempty"`
+	Type        string    `xml:"type,attr,omitempty"`
+	XMLURL      string    `xml:"xmlUrl,attr,omitempty"`
+	HTMLURL     string    `xml:"htmlUrl,attr,omitempty"`
+	Description string    `xml:"description,attr,omitempty"`
+	Outlines    []Outline `xml:"outline"`
+}
+
+// Name returns the title of the outline, falling back to its text.
+func (o Outline) Name() string {
+	if o.Title != "" {
+		return o.Title
+	}
+	return o.Text
+}
+
+// Parse decodes an OPML 1.0 or 2.0 document.
+func Parse(r io.Reader) (*Document, error) {
+	dec := xml.NewDecoder(r)
+	// OPML files exported by older readers are not always in UTF-8
+	dec.CharsetReader = charset.NewReaderLabel
+
+	doc := &Document{}
+	if err := dec.Decode(doc); err != nil {
+		return nil, err
+	}
+
+	if !strings.HasPrefix(doc.Version, "1.") && !strings.HasPrefix(doc.Version, "2.") {
+		return nil, fmt.Errorf("unsupported opml version '%v'", doc.Version)
+	}
+
+	return doc, nil
+}
+
+// Write encodes the document as OPML 2.0, including the XML declaration.
+func (d Document) Write(w io.Writer) error {
+	d.Version = "2.0"
+
+	if _, err := io.WriteString(w, xml.Header); err != nil {
+		return err
+	}
+
+	enc := xml.NewEncoder(w)
+	enc.Indent("", "  ")
+	if err := enc.Encode(d); err != nil {
+		return err
+	}
+
+	_, err := io.WriteString(w, "\n")
+	return err
+}
+
+// Feed is an outline that points to a feed, along with the name of the outline it is nested in.
+type Feed struct {
+	Outline
+	// Name of the closest enclosing outline, empty for top-level feeds
+	Folder string
+}
+
+// Feeds returns all the outlines that point to a feed, including the nested ones.
+func (d Document) Feeds() (out []Feed) {
+	var walk func(outlines []Outline, folder string)
+	walk = func(outlines []Outline, folder string) {
+		for _, o := range outlines {
+			if o.XMLURL != "" {
+				out = append(out, Feed{o, folder})
+			}
+			walk(o.Outlines, o.Name())
+		}
+	}
+	walk(d.Body.Outlines, "")
+
+	return
+}
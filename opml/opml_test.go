@@ -0,0 +1,82 @@
+package opml_test
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/3elDU/rss-reader-backend/opml"
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestParse(t *testing.T) {
+	tests := map[string]struct {
+		document string
+		want     []string
+	}{
+		"opml 1.0": {
+			`<?xml version="1.0" encoding="ISO-8859-1"?>
+			<opml version="1.0">
+				<head><title>Subscriptions</title></head>
+				<body>
+					<outline text="Caf` + "\xe9" + `" type="rss" xmlUrl="https://example.com/cafe.xml"/>
+				</body>
+			</opml>`,
+			[]string{"/Café https://example.com/cafe.xml"},
+		},
+		"nested opml 2.0": {
+			`<?xml version="1.0" encoding="UTF-8"?>
+			<opml version="2.0">
+				<head><title>Subscriptions</title></head>
+				<body>
+					<outline text="Top" title="Top level" xmlUrl="https://example.com/top.xml"/>
+					<outline text="News">
+						<outline text="First" xmlUrl="https://example.com/first.xml"/>
+						<outline text="Empty folder"/>
+						<outline text="Deeper">
+							<outline text="Second" xmlUrl="https://example.com/second.xml"/>
+						</outline>
+					</outline>
+				</body>
+			</opml>`,
+			[]string{
+				"/Top level https://example.com/top.xml",
+				"News/First https://example.com/first.xml",
+				"Deeper/Second https://example.com/second.xml",
+			},
+		},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			doc, err := opml.Parse(strings.NewReader(test.document))
+			if err != nil {
+				t.Fatalf("failed to parse document: %v", err)
+			}
+
+			got := []string{}
+			for _, o := range doc.Feeds() {
+				got = append(got, o.Folder+"/"+o.Name()+" "+o.XMLURL)
+			}
+
+			if diff := cmp.Diff(test.want, got); diff != "" {
+				t.Errorf("feeds mismatch (-want +got):\n%v", diff)
+			}
+		})
+	}
+}
+
+func TestParseRejectsOtherDocuments(t *testing.T) {
+	documents := map[string]string{
+		"rss feed":        `<rss version="2.0"><channel><title>Feed</title></channel></rss>`,
+		"unknown version": `<opml version="3.0"><body/></opml>`,
+		"not xml":         `{"opml": true}`,
+	}
+
+	for name, doc := range documents {
+		t.Run(name, func(t *testing.T) {
+			if _, err := opml.Parse(strings.NewReader(doc)); err == nil {
+				t.Errorf("expected an error")
+			}
+		})
+	}
+}
@@ -0,0 +1,87 @@
+package refresh
+
+import (
+	"context"
+	"net/http"
+
+	"github.com/3elDU/rss-reader-backend/database"
+	"github.com/mmcdole/gofeed"
+)
+
+type fetchResult struct {
+	// HTTP status of the response
+	Status int
+	// Parsed feed, nil if the feed was not modified since the last fetch
+	Feed *gofeed.Feed
+	// Cache validators from the response, to send with the next request
+	ETag         string
+	LastModified string
+	// Headers of the response, used to schedule the next fetch
+	Header http.Header
+}
+
+// fetch downloads and parses the feed. If the subscription has cache validators from the previous fetch,
+// the request is made conditional, and the parser is not touched when the server says the feed didn't change.
+// When the server responded, the result is returned even along with an error, to report the status of the response.
+func (t *Task) fetch(ctx context.Context, sub database.Subscription) (*fetchResult, error) {
+	req, err := http.NewRequestWithContext(ctx, "GET", sub.Url, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	req.Header.Set("User-Agent", t.Parser.UserAgent)
+	if sub.ETag.Valid {
+		req.Header.Set("If-None-Match", sub.ETag.String)
+	}
+	if sub.LastModified.Valid {
+		req.Header.Set("If-Modified-Since", sub.LastModified.String)
+	}
+
+	client := t.Parser.Client
+	if client == nil {
+		client = http.DefaultClient
+	}
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode == http.StatusNotModified {
+		// Keep the old validators, if the server didn't send new ones
+		return &fetchResult{
+			Status:       resp.StatusCode,
+			Header:       resp.Header,
+			ETag:         headerOr(resp.Header, "ETag", sub.ETag.String),
+			LastModified: headerOr(resp.Header, "Last-Modified", sub.LastModified.String),
+		}, nil
+	}
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return &fetchResult{Status: resp.StatusCode, Header: resp.Header}, gofeed.HTTPError{
+			StatusCode: resp.StatusCode,
+			Status:     resp.Status,
+		}
+	}
+
+	feed, err := t.Parser.Parse(resp.Body)
+	if err != nil {
+		return &fetchResult{Status: resp.StatusCode, Header: resp.Header}, err
+	}
+
+	return &fetchResult{
+		Status:       resp.StatusCode,
+		Feed:         feed,
+		Header:       resp.Header,
+		ETag:         resp.Header.Get("ETag"),
+		LastModified: resp.Header.Get("Last-Modified"),
+	}, nil
+}
+
+func headerOr(h http.Header, key, fallback string) string {
+	if v := h.Get(key); v != "" {
+		return v
+	}
+	return fallback
+}
@@ -3,6 +3,7 @@
 package refresh
 
 import (
+	"context"
 	"log"
 	"time"
 
@@ -12,92 +13,246 @@ import (
 	"github.com/mmcdole/gofeed"
 )
 
-// Refresh task that will run with a specified periodicity.
+const (
+	DefaultWorkers = 4
+	DefaultTimeout = 30 * time.Second
+	// Longest time the task sleeps between checks for due feeds, so that new subscriptions are picked up quickly
+	pollInterval = time.Minute
+)
+
+// Refresh task that fetches each feed when it is due, according to the schedule.
 type Task struct {
-	Ticker *time.Ticker
-	Parser *gofeed.Parser
-	db     *sqlx.DB
-	sr     database.SubscriptionRepository
-	ar     database.ArticleRepository
+	Schedule Schedule
+	Parser   *gofeed.Parser
+	// Number of feeds that are fetched at the same time
+	Workers int
+	// Maximum time that fetching a single feed can take
+	Timeout time.Duration
+	db      *sqlx.DB
+	sr      database.SubscriptionRepository
+	ar      database.ArticleRepository
 }
 
-func NewTask(db *sqlx.DB, freq time.Duration) *Task {
+func NewTask(db *sqlx.DB, schedule Schedule) *Task {
+	parser := gofeed.NewParser()
+	parser.RSSTranslator = &rssTranslator{}
+
 	return &Task{
-		Ticker: time.NewTicker(freq),
-		Parser: gofeed.NewParser(),
-		db:     db,
-		sr:     database.NewSubscriptionRepository(db),
-		ar:     database.NewArticleRepository(db),
+		Schedule: schedule,
+		Parser:   parser,
+		Workers:  DefaultWorkers,
+		Timeout:  DefaultTimeout,
+		db:       db,
+		sr:       database.NewSubscriptionRepository(db),
+		ar:       database.NewArticleRepository(db),
 	}
 }
 
-// Run blocks indefinetely, and runs the Refresh function in repeated intervals
+// Run blocks indefinetely, refreshing the feeds as they become due
 func (t *Task) Run() {
 	for {
-		<-t.Ticker.C
-
-		if _, err := t.Refresh(); err != nil {
+		res, err := t.RefreshDue()
+		if err != nil {
 			log.Printf("feed refresh error: %v", err)
+		} else if res.Failed != 0 {
+			log.Printf("%v of %v feeds failed to refresh", res.Failed, len(res.Feeds))
 		}
+
+		time.Sleep(t.untilNextRefresh())
 	}
 }
 
-// Refresh all the feeds. This function can also be called manually.
-func (t *Task) Refresh() ([]resource.Article, error) {
-	f, err := t.sr.All()
+// untilNextRefresh returns how long to wait until the next feed is due
+func (t *Task) untilNextRefresh() time.Duration {
+	next, ok, err := t.sr.NextRefresh()
+	if err != nil {
+		log.Printf("failed to get the next refresh time: %v", err)
+		return pollInterval
+	}
+	if !ok {
+		return pollInterval
+	}
+
+	return min(max(time.Until(next), time.Second), pollInterval)
+}
+
+// FeedResult describes the refresh of a single feed
+type FeedResult struct {
+	SubscriptionId int64 `json:"subscriptionId"`
+	// Number of articles that were added to the database
+	NewArticles int `json:"newArticles"`
+	// Number of articles that were changed by the publisher, and updated in the database
+	UpdatedArticles int `json:"updatedArticles"`
+	// Whether the feed didn't change since the last refresh
+	Unchanged bool `json:"unchanged"`
+	// How long it took to fetch and store the feed, in milliseconds
+	DurationMs int64 `json:"durationMs"`
+	// Empty if the refresh was successful
+	Error string `json:"error,omitempty"`
+	// When the feed will be fetched next, in time.DateTime format
+	NextRefreshAt string `json:"nextRefreshAt,omitempty"`
+}
+
+// Result of refreshing all the feeds
+type Result struct {
+	// Results for each feed, in the same order as the subscriptions
+	Feeds []FeedResult `json:"feeds"`
+	// Total number of articles that were added to the database
+	NewArticles int `json:"newArticles"`
+	// Total number of articles that were updated
+	UpdatedArticles int `json:"updatedArticles"`
+	// Number of feeds that didn't change since the last refresh
+	Unchanged int `json:"unchanged"`
+	// Number of feeds that failed to refresh
+	Failed int `json:"failed"`
+}
+
+// Feed fetched by one of the workers
+type fetched struct {
+	index   int
+	sub     database.Subscription
+	res     *fetchResult
+	err     error
+	started time.Time
+}
+
+// Refresh all the feeds, regardless of when they are due. This function can also be called manually.
+func (t *Task) Refresh() (*Result, error) {
+	subs, err := t.sr.All()
 	if err != nil {
 		return nil, err
 	}
 
-	// Articles currently in the database
-	adb, err := t.ar.All()
+	return t.refresh(subs)
+}
+
+// RefreshDue refreshes only the feeds which are due according to the schedule.
+func (t *Task) RefreshDue() (*Result, error) {
+	subs, err := t.sr.Due(time.Now())
 	if err != nil {
 		return nil, err
 	}
 
-	// All articles fetched from all feeds
-	af, err := t.collectNewArticles(f)
+	return t.refresh(subs)
+}
+
+// RefreshDueForUser refreshes the feeds the user is subscribed to which are due according to the schedule.
+// Feeds are shared between the users, so a user can't make them fetched more often than the schedule and the backoff allow.
+func (t *Task) RefreshDueForUser(userId int64) (*Result, error) {
+	subs, err := t.sr.DueForUser(userId, time.Now())
 	if err != nil {
 		return nil, err
 	}
 
-	na := []resource.Article{}
+	return t.refresh(subs)
+}
+
+// refresh fetches the given feeds and schedules their next refresh.
+//
+// Feeds are fetched concurrently by a pool of workers, and an error in one feed doesn't affect the others.
+// Errors of the individual feeds are reported in the result, and the returned error is not nil
+// only if the refresh couldn't be started at all.
+func (t *Task) refresh(subs []database.Subscription) (*Result, error) {
+	jobs := make(chan int)
+	done := make(chan fetched)
 
-	// Compare two slices, and add new articles to the database
-	for _, anew := range af {
-		new := true
+	for range max(t.Workers, 1) {
+		go func() {
+			for i := range jobs {
+				started := time.Now()
+				ctx, cancel := context.WithTimeout(context.Background(), t.Timeout)
+				fr, err := t.fetch(ctx, subs[i])
+				cancel()
 
-		for _, aold := range adb {
-			if aold.Url == anew.Url {
-				new = false
-				break
+				done <- fetched{i, subs[i], fr, err, started}
 			}
+		}()
+	}
+
+	go func() {
+		for i := range subs {
+			jobs <- i
 		}
+		close(jobs)
+	}()
 
-		if new {
-			if err := t.ar.InsertArticle(&anew); err != nil {
-				return nil, err
-			}
-			na = append(na, resource.NewArticle(anew))
+	res := &Result{Feeds: make([]FeedResult, len(subs))}
+
+	// Database writes happen only here, one feed at a time, so that the workers don't compete for the database
+	for range subs {
+		f := <-done
+		fr := &res.Feeds[f.index]
+		fr.SubscriptionId = f.sub.ID
+
+		err := f.err
+		if err == nil {
+			fr.Unchanged = f.res.Feed == nil
+			fr.NewArticles, fr.UpdatedArticles, err = t.store(f.sub, f.res)
+		}
+
+		status := 0
+		if f.res != nil {
+			status = f.res.Status
+		}
+		if herr := t.sr.RecordAttempt(&f.sub, status, err); herr != nil {
+			log.Printf("failed to record feed health: %v", herr)
+		}
+
+		if next, serr := t.scheduleNext(&f.sub, f.res); serr != nil {
+			log.Printf("failed to schedule the next refresh: %v", serr)
+		} else {
+			fr.NextRefreshAt = next.UTC().Format(time.DateTime)
 		}
+
+		fr.DurationMs = time.Since(f.started).Milliseconds()
+
+		if err != nil {
+			log.Printf("feed refresh error: %v: %v", f.sub.Url, err)
+			fr.Error = err.Error()
+			res.Failed++
+		} else if fr.Unchanged {
+			res.Unchanged++
+		}
+		res.NewArticles += fr.NewArticles
+		res.UpdatedArticles += fr.UpdatedArticles
 	}
 
-	return na, nil
+	return res, nil
 }
 
-// Fetch all articles from each feed via gofeed, and put them all into one array
-func (t *Task) collectNewArticles(feeds []database.Subscription) (out []database.Article, err error) {
-	for _, f := range feeds {
-		gf, err := t.Parser.ParseURL(f.Url)
-		if err != nil {
-			return nil, err
+// store adds new articles from the fetched feed to the database, and updates the ones that changed.
+// It returns how many articles were added and updated. Articles that are already in the database are found
+// by the database itself, so the archive is never loaded.
+func (t *Task) store(sub database.Subscription, fr *fetchResult) (new int, updated int, err error) {
+
+	if fr.Feed != nil {
+		articles := []database.Article{}
+		for _, ar := range resource.NewArticlesFromGofeed(fr.Feed.Items, sub.ID) {
+			articles = append(articles, ar.ToModel())
 		}
 
-		art := resource.NewArticlesFromGofeed(gf.Items, f.ID)
-		for _, a := range art {
-			out = append(out, a.ToModel())
+		if new, updated, err = t.ar.BulkAddArticles(articles); err != nil {
+			return 0, 0, err
 		}
 	}
 
-	return
+	// Validators are saved only after the articles, so that they are not lost if inserting fails
+	return new, updated, t.sr.UpdateCacheHeaders(&sub, fr.ETag, fr.LastModified)
+}
+
+// scheduleNext computes and stores when the feed should be fetched next. The health of the feed must be recorded before.
+func (t *Task) scheduleNext(sub *database.Subscription, fr *fetchResult) (time.Time, error) {
+	recent, err := t.ar.RecentDates(sub.ID, frequencySample)
+	if err != nil {
+		return time.Time{}, err
+	}
+
+	now := time.Now()
+	h := scheduleHints{}
+	if fr != nil {
+		h = newScheduleHints(now, fr.Header, fr.Feed)
+	}
+
+	next := t.Schedule.next(now, recent, sub.FailureCount, h)
+	return next, t.sr.ScheduleRefresh(sub, next)
 }
@@ -0,0 +1,523 @@
+package refresh_test
+
+import (
+	"database/sql"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/3elDU/rss-reader-backend/database"
+	"github.com/3elDU/rss-reader-backend/refresh"
+	"github.com/golang-migrate/migrate/v4"
+	"github.com/golang-migrate/migrate/v4/database/sqlite"
+	"github.com/jmoiron/sqlx"
+
+	_ "modernc.org/sqlite"
+)
+
+const testFeed = `<?xml version="1.0" encoding="UTF-8"?>
+<rss version="2.0">
+	<channel>
+		<title>Test Feed</title>
+		<item>
+			<title>Test Article</title>
+			<link>https://example.com/test-article</link>
+		</item>
+	</channel>
+</rss>`
+
+func newTestDB(t *testing.T) *sqlx.DB {
+	godb, err := database.NewWithMigrations(":memory:", "../database/migrations")
+	if err != nil {
+		t.Fatal(err)
+	}
+	db := sqlx.NewDb(godb, "sqlite")
+	t.Cleanup(func() { db.Close() })
+
+	return db
+}
+
+func subscribe(t *testing.T, db *sqlx.DB, url string) database.Subscription {
+	sub := database.Subscription{Type: "rss", Url: url, Title: "Test Feed"}
+	repo := database.NewSubscriptionRepository(db)
+	if err := repo.InsertSubscription(&sub); err != nil {
+		t.Fatal(err)
+	}
+	if err := repo.Subscribe(database.DefaultUserId, &sub); err != nil {
+		t.Fatal(err)
+	}
+
+	return sub
+}
+
+func TestConditionalRefresh(t *testing.T) {
+	const etag = `"v1"`
+	const lastModified = "Tue, 24 Dec 2024 00:00:00 GMT"
+
+	requests := 0
+	feed := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+
+		if r.Header.Get("If-None-Match") == etag && r.Header.Get("If-Modified-Since") == lastModified {
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
+
+		w.Header().Set("ETag", etag)
+		w.Header().Set("Last-Modified", lastModified)
+		w.Write([]byte(testFeed))
+	}))
+	defer feed.Close()
+
+	db := newTestDB(t)
+	sub := subscribe(t, db, feed.URL)
+	task := refresh.NewTask(db, refresh.DefaultSchedule)
+
+	res, err := task.Refresh()
+	if err != nil {
+		t.Fatalf("first refresh failed: %v", err)
+	}
+	if res.NewArticles != 1 || res.Unchanged != 0 {
+		t.Errorf("expected 1 new article and no unchanged feeds, got %v and %v", res.NewArticles, res.Unchanged)
+	}
+
+	stored, err := database.NewSubscriptionRepository(db).Find(sub.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stored.ETag.String != etag || stored.LastModified.String != lastModified {
+		t.Errorf("cache headers were not stored, got '%v' and '%v'", stored.ETag.String, stored.LastModified.String)
+	}
+
+	res, err = task.Refresh()
+	if err != nil {
+		t.Fatalf("second refresh failed: %v", err)
+	}
+	if res.NewArticles != 0 || res.Unchanged != 1 || !res.Feeds[0].Unchanged {
+		t.Errorf("expected no new articles and 1 unchanged feed, got %v and %v", res.NewArticles, res.Unchanged)
+	}
+
+	if requests != 2 {
+		t.Errorf("expected 2 requests to the feed, got %v", requests)
+	}
+}
+
+func TestRefreshIsolatesFailures(t *testing.T) {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/ok", func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(testFeed))
+	})
+	mux.HandleFunc("/broken", func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusInternalServerError)
+	})
+	mux.HandleFunc("/invalid", func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("not a feed"))
+	})
+	mux.HandleFunc("/slow", func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case <-r.Context().Done():
+		case <-time.After(5 * time.Second):
+		}
+	})
+	feeds := httptest.NewServer(mux)
+	defer feeds.Close()
+
+	db := newTestDB(t)
+	for _, path := range []string{"/broken", "/slow", "/ok", "/invalid"} {
+		subscribe(t, db, feeds.URL+path)
+	}
+
+	task := refresh.NewTask(db, refresh.DefaultSchedule)
+	task.Timeout = 100 * time.Millisecond
+
+	res, err := task.Refresh()
+	if err != nil {
+		t.Fatalf("refresh failed: %v", err)
+	}
+
+	if res.NewArticles != 1 || res.Failed != 3 || len(res.Feeds) != 4 {
+		t.Fatalf("expected 1 new article and 3 failed feeds out of 4, got %+v", res)
+	}
+
+	for i, f := range res.Feeds {
+		if f.SubscriptionId != int64(i+1) {
+			t.Errorf("results are not in the order of the subscriptions: %+v", res.Feeds)
+		}
+
+		// Only the third feed works
+		if failed := f.Error != ""; failed != (i != 2) {
+			t.Errorf("unexpected result for feed %v: %+v", i+1, f)
+		}
+	}
+
+	// Refresh again, so that failures pile up
+	if _, err := task.Refresh(); err != nil {
+		t.Fatalf("refresh failed: %v", err)
+	}
+
+	repo := database.NewSubscriptionRepository(db)
+	tests := []struct {
+		id           int64
+		failureCount int64
+		lastStatus   int64
+		failed       bool
+	}{
+		{1, 2, 500, true},
+		// Timed out, so there's no response status
+		{2, 2, 0, true},
+		{3, 0, 200, false},
+		// The response was fine, but it's not a feed
+		{4, 2, 200, true},
+	}
+
+	for _, test := range tests {
+		sub, err := repo.Find(test.id)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if sub.FailureCount != test.failureCount || sub.LastStatus.Int64 != test.lastStatus || sub.LastError.Valid != test.failed {
+			t.Errorf("unexpected health of feed %v: failures %v, status %v, error '%v'",
+				test.id, sub.FailureCount, sub.LastStatus.Int64, sub.LastError.String,
+			)
+		}
+		if !sub.LastAttemptAt.Valid || sub.LastSuccessAt.Valid == test.failed {
+			t.Errorf("unexpected refresh times of feed %v: attempt '%v', success '%v'",
+				test.id, sub.LastAttemptAt.String, sub.LastSuccessAt.String,
+			)
+		}
+	}
+
+	failing, err := repo.WithStatus(database.DefaultUserId, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(failing) != 3 {
+		t.Errorf("expected 3 failing feeds, got %v", len(failing))
+	}
+}
+
+func TestRefreshDue(t *testing.T) {
+	requests := 0
+	feed := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		w.Header().Set("Cache-Control", "max-age=7200")
+		w.Write([]byte(testFeed))
+	}))
+	defer feed.Close()
+
+	db := newTestDB(t)
+	sub := subscribe(t, db, feed.URL)
+	task := refresh.NewTask(db, refresh.DefaultSchedule)
+
+	// The feed was never fetched, so it's due right away
+	res, err := task.RefreshDue()
+	if err != nil {
+		t.Fatalf("refresh failed: %v", err)
+	}
+	if len(res.Feeds) != 1 || res.Feeds[0].NextRefreshAt == "" {
+		t.Fatalf("expected the feed to be refreshed and scheduled, got %+v", res)
+	}
+
+	stored, err := database.NewSubscriptionRepository(db).Find(sub.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	next, err := time.Parse(time.DateTime, stored.NextRefreshAt.String)
+	if err != nil {
+		t.Fatalf("invalid next refresh time '%v': %v", stored.NextRefreshAt.String, err)
+	}
+	if until := time.Until(next); until < time.Hour || until > 2*time.Hour {
+		t.Errorf("expected the next refresh in about 2 hours because of max-age, got %v", until)
+	}
+
+	// Now it's scheduled in the future, so it's skipped
+	res, err = task.RefreshDue()
+	if err != nil {
+		t.Fatalf("refresh failed: %v", err)
+	}
+	if len(res.Feeds) != 0 {
+		t.Errorf("expected no feeds to be due, got %+v", res.Feeds)
+	}
+
+	// But a manual refresh fetches it anyway
+	if _, err := task.Refresh(); err != nil {
+		t.Fatalf("refresh failed: %v", err)
+	}
+	if requests != 2 {
+		t.Errorf("expected 2 requests to the feed, got %v", requests)
+	}
+}
+
+func TestRefreshDeduplicatesByGuid(t *testing.T) {
+	const guidFeed = `<?xml version="1.0" encoding="UTF-8"?>
+<rss version="2.0">
+	<channel>
+		<title>Test Feed</title>
+		<item>
+			<title>First</title>
+			<guid isPermaLink="false">first</guid>
+			<link>https://example.com/shared</link>
+		</item>
+		<item>
+			<title>Second</title>
+			<guid isPermaLink="false">second</guid>
+			<link>https://example.com/shared</link>
+		</item>
+		<item>
+			<title>No link</title>
+			<description>Only the content identifies this one</description>
+		</item>
+	</channel>
+</rss>`
+
+	// Tracking parameters change on every request, but the guids stay the same
+	requests := 0
+	feed := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		w.Write([]byte(strings.ReplaceAll(guidFeed, "/shared", fmt.Sprintf("/shared?utm=%v", requests))))
+	}))
+	defer feed.Close()
+
+	db := newTestDB(t)
+	subscribe(t, db, feed.URL)
+	task := refresh.NewTask(db, refresh.DefaultSchedule)
+
+	for i := range 2 {
+		res, err := task.Refresh()
+		if err != nil {
+			t.Fatalf("refresh failed: %v", err)
+		}
+
+		want := 3
+		if i != 0 {
+			want = 0
+		}
+		if res.NewArticles != want {
+			t.Errorf("refresh %v: expected %v new articles, got %v", i+1, want, res.NewArticles)
+		}
+	}
+
+	articles, err := database.NewArticleRepository(db).All()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	guids := []string{}
+	for _, a := range articles {
+		guids = append(guids, a.Guid)
+	}
+	if len(guids) != 3 || guids[0] != "first" || guids[1] != "second" || !strings.HasPrefix(guids[2], "sha256:") {
+		t.Errorf("unexpected guids: %v", guids)
+	}
+}
+
+func TestRefreshUpdatesArticles(t *testing.T) {
+	const updatingFeed = `<?xml version="1.0" encoding="UTF-8"?>
+<rss version="2.0">
+	<channel>
+		<title>Test Feed</title>
+		<item>
+			<title>%v</title>
+			<guid>https://example.com/dated</guid>
+			<pubDate>Tue, 24 Dec 2024 00:00:00 GMT</pubDate>
+		</item>
+		<item>
+			<title>Undated</title>
+			<guid>https://example.com/undated</guid>
+		</item>
+	</channel>
+</rss>`
+
+	title := "Typo in the titel"
+	feed := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprintf(w, updatingFeed, title)
+	}))
+	defer feed.Close()
+
+	db := newTestDB(t)
+	subscribe(t, db, feed.URL)
+	task := refresh.NewTask(db, refresh.DefaultSchedule)
+	repo := database.NewArticleRepository(db)
+
+	if _, err := task.Refresh(); err != nil {
+		t.Fatalf("refresh failed: %v", err)
+	}
+
+	dated, err := repo.Find(1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := repo.MarkRead(database.DefaultUserId, dated); err != nil {
+		t.Fatal(err)
+	}
+	undated, err := repo.Find(2)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Nothing changed, so nothing is updated, even though the undated article has no date in the feed
+	res, err := task.Refresh()
+	if err != nil {
+		t.Fatalf("refresh failed: %v", err)
+	}
+	if res.NewArticles != 0 || res.UpdatedArticles != 0 {
+		t.Errorf("expected no new or updated articles, got %v and %v", res.NewArticles, res.UpdatedArticles)
+	}
+
+	title = "Typo in the title"
+	res, err = task.Refresh()
+	if err != nil {
+		t.Fatalf("refresh failed: %v", err)
+	}
+	if res.NewArticles != 0 || res.UpdatedArticles != 1 {
+		t.Errorf("expected 1 updated article, got %v new and %v updated", res.NewArticles, res.UpdatedArticles)
+	}
+
+	updated, err := repo.FindForUser(database.DefaultUserId, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if updated.Title != title || !updated.UpdatedAt.Valid || !updated.ReadAt.Valid {
+		t.Errorf("expected the title to be updated and the article to stay read, got %+v", updated.Article)
+	}
+	if updated.Created.String != "2024-12-24 00:00:00" {
+		t.Errorf("unexpected creation date: %v", updated.Created.String)
+	}
+
+	stillUndated, err := repo.Find(2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stillUndated.Created != undated.Created || stillUndated.UpdatedAt.Valid {
+		t.Errorf("undated article changed: %+v", stillUndated)
+	}
+}
+
+// Articles stored before the guids were introduced keep their state when the feed has guids that differ from the links
+func TestRefreshKeepsLegacyArticles(t *testing.T) {
+	feed := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`<?xml version="1.0" encoding="UTF-8"?>
+<rss version="2.0">
+	<channel>
+		<title>Test Feed</title>
+		<item>
+			<title>Legacy</title>
+			<guid isPermaLink="false">tag:example.com,2024:legacy</guid>
+			<link>https://example.com/legacy</link>
+			<pubDate>Tue, 24 Dec 2024 00:00:00 GMT</pubDate>
+		</item>
+	</channel>
+</rss>`))
+	}))
+	defer feed.Close()
+
+	path := filepath.Join(t.TempDir(), "legacy.sqlite")
+	godb, err := sql.Open("sqlite", path+"?_pragma=foreign_keys(1)")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer godb.Close()
+
+	driver, err := sqlite.WithInstance(godb, &sqlite.Config{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	m, err := migrate.NewWithDatabaseInstance("file://../database/migrations", "sqlite", driver)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Last migration before the guids
+	if err := m.Migrate(10); err != nil {
+		t.Fatal(err)
+	}
+	for _, q := range []string{
+		fmt.Sprintf("INSERT INTO subscriptions (type, url, title) VALUES ('rss', '%v', 'Test Feed')", feed.URL),
+		`INSERT INTO articles (subscription_id, new, url, title, created, readlater, created_readlater)
+			VALUES (1, FALSE, 'https://example.com/legacy', 'Legacy', '2024-12-24 00:00:00', TRUE, '2024-12-25 00:00:00')`,
+	} {
+		if _, err := godb.Exec(q); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := m.Up(); err != nil {
+		t.Fatal(err)
+	}
+	db := sqlx.NewDb(godb, "sqlite")
+
+	res, err := refresh.NewTask(db, refresh.DefaultSchedule).Refresh()
+	if err != nil {
+		t.Fatalf("refresh failed: %v", err)
+	}
+	if res.NewArticles != 0 {
+		t.Errorf("legacy article was added again: %v new articles", res.NewArticles)
+	}
+
+	repo := database.NewArticleRepository(db)
+	articles, err := repo.All()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(articles) != 1 || articles[0].Guid != "tag:example.com,2024:legacy" {
+		t.Fatalf("legacy article should take over the guid of the item: %+v", articles)
+	}
+
+	a, err := repo.FindForUser(database.DefaultUserId, articles[0].ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !a.ReadAt.Valid || !a.ReadLater {
+		t.Errorf("state of the legacy article was lost: %+v", a.Article)
+	}
+}
+
+// Feeds are shared, so a user refreshing their feeds doesn't fetch them more often than the schedule allows
+func TestRefreshDueForUser(t *testing.T) {
+	requests := 0
+	feed := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		w.Write([]byte(testFeed))
+	}))
+	defer feed.Close()
+
+	db := newTestDB(t)
+	subscribe(t, db, feed.URL)
+	task := refresh.NewTask(db, refresh.DefaultSchedule)
+
+	bob := database.User{Name: "bob"}
+	if err := database.NewUserRepository(db).Insert(&bob); err != nil {
+		t.Fatal(err)
+	}
+
+	res, err := task.RefreshDueForUser(bob.ID)
+	if err != nil {
+		t.Fatalf("refresh failed: %v", err)
+	}
+	if len(res.Feeds) != 0 {
+		t.Errorf("feeds of other users should not be refreshed, got %+v", res.Feeds)
+	}
+
+	for i := range 2 {
+		res, err := task.RefreshDueForUser(database.DefaultUserId)
+		if err != nil {
+			t.Fatalf("refresh failed: %v", err)
+		}
+
+		want := 1
+		if i != 0 {
+			want = 0
+		}
+		if len(res.Feeds) != want {
+			t.Errorf("refresh %v: expected %v feeds to be refreshed, got %+v", i+1, want, res.Feeds)
+		}
+	}
+
+	if requests != 1 {
+		t.Errorf("expected 1 request to the feed, got %v", requests)
+	}
+}
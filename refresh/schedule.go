@@ -0,0 +1,222 @@
+package refresh
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/mmcdole/gofeed"
+	"github.com/mmcdole/gofeed/rss"
+)
+
+// Schedule decides how often each feed is fetched.
+//
+// Feeds that work are fetched about twice as often as they publish articles, within [MinInterval, MaxInterval].
+// The publisher can ask for a longer interval with the RSS <ttl>, Cache-Control: max-age or Retry-After, up to MaxBackoff,
+// and the feed is never fetched during its RSS skipHours and skipDays. Feeds that fail are backed off exponentially, up to MaxBackoff.
+type Schedule struct {
+	// Feeds are not fetched more often than this
+	MinInterval time.Duration
+	// Feeds that work are fetched at least this often, unless the publisher asks otherwise
+	MaxInterval time.Duration
+	// Longest interval between attempts to fetch a failing feed, and the longest the publisher can ask for
+	MaxBackoff time.Duration
+}
+
+var DefaultSchedule = Schedule{
+	MinInterval: 15 * time.Minute,
+	MaxInterval: 24 * time.Hour,
+	MaxBackoff:  48 * time.Hour,
+}
+
+// Number of the newest articles used to estimate how often the feed publishes
+const frequencySample = 10
+
+// Keys in gofeed.Feed.Custom, under which the RSS scheduling elements are kept
+const (
+	customTTL       = "rss:ttl"
+	customSkipHours = "rss:skipHours"
+	customSkipDays  = "rss:skipDays"
+)
+
+// Hints from the feed and the HTTP response about when the feed should be fetched next
+type scheduleHints struct {
+	// RSS <ttl>
+	TTL time.Duration
+	// Cache-Control: max-age
+	MaxAge time.Duration
+	// Retry-After
+	RetryAfter time.Duration
+	// RSS skipHours, in UTC
+	SkipHours map[int]bool
+	// RSS skipDays
+	SkipDays map[time.Weekday]bool
+}
+
+// next returns when the feed should be fetched next.
+// recent are the creation dates of the newest articles of the feed, and failures is the number of failed refreshes in a row.
+func (s Schedule) next(now time.Time, recent []time.Time, failures int64, h scheduleHints) time.Time {
+	var interval time.Duration
+	if failures > 0 {
+		interval = s.backoff(failures)
+	} else {
+		interval = max(s.frequency(now, recent), h.TTL, h.MaxAge)
+	}
+	interval = max(interval, h.RetryAfter)
+
+	// Hints like a max-age of a year are common for static files, and would stop the feed from being fetched
+	return h.skip(now.Add(min(interval, max(s.MaxBackoff, s.MaxInterval))))
+}
+
+// frequency estimates the interval from the average time between the recent articles
+func (s Schedule) frequency(now time.Time, recent []time.Time) time.Duration {
+	if len(recent) == 0 {
+		return s.MaxInterval
+	}
+
+	oldest := recent[0]
+	for _, t := range recent {
+		if t.Before(oldest) {
+			oldest = t
+		}
+	}
+
+	interval := now.Sub(oldest) / time.Duration(len(recent)) / 2
+	return min(max(interval, s.MinInterval), s.MaxInterval)
+}
+
+func (s Schedule) backoff(failures int64) time.Duration {
+	interval := s.MinInterval
+	for i := int64(1); i < failures && interval < s.MaxBackoff; i++ {
+		interval *= 2
+	}
+
+	return min(interval, s.MaxBackoff)
+}
+
+// skip moves t to the start of the first hour that is not skipped
+func (h scheduleHints) skip(t time.Time) time.Time {
+	// A week is enough to get through all combinations, in case every hour is skipped
+	for range 24 * 8 {
+		u := t.UTC()
+		if !h.SkipHours[u.Hour()] && !h.SkipDays[u.Weekday()] {
+			break
+		}
+		t = u.Truncate(time.Hour).Add(time.Hour)
+	}
+
+	return t
+}
+
+// newScheduleHints collects the hints from the response headers and the feed. Both of them can be nil.
+func newScheduleHints(now time.Time, header http.Header, feed *gofeed.Feed) scheduleHints {
+	h := scheduleHints{}
+
+	if header != nil {
+		h.MaxAge = maxAge(header.Get("Cache-Control"))
+		h.RetryAfter = retryAfter(now, header.Get("Retry-After"))
+	}
+
+	if feed != nil && feed.Custom != nil {
+		if ttl, err := strconv.ParseInt(feed.Custom[customTTL], 10, 64); err == nil && ttl > 0 {
+			h.TTL = hintDuration(ttl, time.Minute)
+		}
+
+		for _, hour := range strings.Split(feed.Custom[customSkipHours], ",") {
+			if n, err := strconv.Atoi(strings.TrimSpace(hour)); err == nil && n >= 0 && n < 24 {
+				if h.SkipHours == nil {
+					h.SkipHours = map[int]bool{}
+				}
+				h.SkipHours[n] = true
+			}
+		}
+
+		for _, day := range strings.Split(feed.Custom[customSkipDays], ",") {
+			for d := time.Sunday; d <= time.Saturday; d++ {
+				if strings.EqualFold(strings.TrimSpace(day), d.String()) {
+					if h.SkipDays == nil {
+						h.SkipDays = map[time.Weekday]bool{}
+					}
+					h.SkipDays[d] = true
+				}
+			}
+		}
+	}
+
+	return h
+}
+
+// Hints are capped by the schedule anyway, so anything longer than this is the same
+const maxHint = 365 * 24 * time.Hour
+
+// hintDuration converts the number of units in a hint to a duration, without overflowing for huge numbers
+func hintDuration(n int64, unit time.Duration) time.Duration {
+	if n > int64(maxHint/unit) {
+		return maxHint
+	}
+
+	return time.Duration(n) * unit
+}
+
+func maxAge(cacheControl string) time.Duration {
+	for _, directive := range strings.Split(cacheControl, ",") {
+		name, value, _ := strings.Cut(strings.TrimSpace(directive), "=")
+		if strings.EqualFold(name, "max-age") {
+			if n, err := strconv.ParseInt(strings.Trim(value, `"`), 10, 64); err == nil && n > 0 {
+				return hintDuration(n, time.Second)
+			}
+		}
+	}
+
+	return 0
+}
+
+// retryAfter parses the header, which is either a number of seconds or an HTTP date
+func retryAfter(now time.Time, value string) time.Duration {
+	if value == "" {
+		return 0
+	}
+
+	if n, err := strconv.ParseInt(value, 10, 64); err == nil {
+		return hintDuration(max(n, 0), time.Second)
+	}
+
+	if t, err := http.ParseTime(value); err == nil {
+		return max(t.Sub(now), 0)
+	}
+
+	return 0
+}
+
+// rssTranslator keeps the RSS scheduling elements, which the default translator drops, in gofeed.Feed.Custom
+type rssTranslator struct {
+	gofeed.DefaultRSSTranslator
+}
+
+func (t *rssTranslator) Translate(feed interface{}) (*gofeed.Feed, error) {
+	f, err := t.DefaultRSSTranslator.Translate(feed)
+	if err != nil {
+		return nil, err
+	}
+
+	rf, ok := feed.(*rss.Feed)
+	if !ok {
+		return f, nil
+	}
+
+	if f.Custom == nil {
+		f.Custom = map[string]string{}
+	}
+	if rf.TTL != "" {
+		f.Custom[customTTL] = strings.TrimSpace(rf.TTL)
+	}
+	if len(rf.SkipHours) != 0 {
+		f.Custom[customSkipHours] = strings.Join(rf.SkipHours, ",")
+	}
+	if len(rf.SkipDays) != 0 {
+		f.Custom[customSkipDays] = strings.Join(rf.SkipDays, ",")
+	}
+
+	return f, nil
+}
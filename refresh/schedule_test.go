@@ -0,0 +1,108 @@
+package refresh
+
+import (
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/mmcdole/gofeed"
+)
+
+var testSchedule = Schedule{
+	MinInterval: 15 * time.Minute,
+	MaxInterval: 24 * time.Hour,
+	MaxBackoff:  48 * time.Hour,
+}
+
+// Wednesday, at noon
+var testNow = time.Date(2024, time.December, 25, 12, 0, 0, 0, time.UTC)
+
+// every returns n article dates, spaced by the interval, going back from testNow
+func every(n int, interval time.Duration) []time.Time {
+	dates := []time.Time{}
+	for i := range n {
+		dates = append(dates, testNow.Add(-time.Duration(i+1)*interval))
+	}
+	return dates
+}
+
+func TestScheduleNext(t *testing.T) {
+	tests := []struct {
+		name     string
+		recent   []time.Time
+		failures int64
+		hints    scheduleHints
+		want     time.Duration
+	}{
+		{"no articles", nil, 0, scheduleHints{}, 24 * time.Hour},
+		{"hourly feed", every(10, time.Hour), 0, scheduleHints{}, 30 * time.Minute},
+		{"busy feed", every(10, time.Minute), 0, scheduleHints{}, 15 * time.Minute},
+		{"weekly feed", every(10, 7*24*time.Hour), 0, scheduleHints{}, 24 * time.Hour},
+		{"ttl", every(10, time.Hour), 0, scheduleHints{TTL: 2 * time.Hour}, 2 * time.Hour},
+		{"max-age", every(10, time.Hour), 0, scheduleHints{MaxAge: 3 * time.Hour}, 3 * time.Hour},
+		{"short ttl", every(10, time.Hour), 0, scheduleHints{TTL: time.Minute}, 30 * time.Minute},
+		{"first failure", every(10, time.Hour), 1, scheduleHints{}, 15 * time.Minute},
+		{"third failure", every(10, time.Hour), 3, scheduleHints{}, time.Hour},
+		{"many failures", every(10, time.Hour), 100, scheduleHints{}, 48 * time.Hour},
+		{"retry-after", nil, 1, scheduleHints{RetryAfter: 5 * time.Hour}, 5 * time.Hour},
+		{"max-age of a year", every(10, time.Hour), 0, newScheduleHints(testNow, http.Header{"Cache-Control": {"max-age=31536000"}}, nil), 48 * time.Hour},
+		{"huge retry-after", nil, 1, newScheduleHints(testNow, http.Header{"Retry-After": {"99999999999"}}, nil), 48 * time.Hour},
+		{"skip hours", every(10, time.Hour), 0, scheduleHints{SkipHours: map[int]bool{12: true, 13: true}}, 2 * time.Hour},
+		{"skip days", every(10, time.Hour), 0, scheduleHints{SkipDays: map[time.Weekday]bool{time.Wednesday: true}}, 12 * time.Hour},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			got := testSchedule.next(testNow, test.recent, test.failures, test.hints).Sub(testNow)
+			if got != test.want {
+				t.Errorf("expected the next refresh in %v, got %v", test.want, got)
+			}
+		})
+	}
+}
+
+func TestScheduleHints(t *testing.T) {
+	header := http.Header{}
+	header.Set("Cache-Control", "public, max-age=600")
+	header.Set("Retry-After", testNow.Add(time.Hour).Format(http.TimeFormat))
+
+	parser := gofeed.NewParser()
+	parser.RSSTranslator = &rssTranslator{}
+	feed, err := parser.Parse(strings.NewReader(`<rss version="2.0"><channel>
+		<title>Test Feed</title>
+		<ttl>60</ttl>
+		<skipHours><hour>0</hour><hour>23</hour></skipHours>
+		<skipDays><day>Sunday</day></skipDays>
+	</channel></rss>`))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	h := newScheduleHints(testNow, header, feed)
+	if h.MaxAge != 10*time.Minute {
+		t.Errorf("expected max-age of 10m, got %v", h.MaxAge)
+	}
+	if h.RetryAfter != time.Hour {
+		t.Errorf("expected retry-after of 1h, got %v", h.RetryAfter)
+	}
+	if h.TTL != time.Hour {
+		t.Errorf("expected ttl of 1h, got %v", h.TTL)
+	}
+	if len(h.SkipHours) != 2 || !h.SkipHours[0] || !h.SkipHours[23] {
+		t.Errorf("expected to skip hours 0 and 23, got %v", h.SkipHours)
+	}
+	if len(h.SkipDays) != 1 || !h.SkipDays[time.Sunday] {
+		t.Errorf("expected to skip sundays, got %v", h.SkipDays)
+	}
+
+	if got := retryAfter(testNow, "120"); got != 2*time.Minute {
+		t.Errorf("expected retry-after of 2m, got %v", got)
+	}
+	if got := maxAge("max-age=31536000"); got != 365*24*time.Hour {
+		t.Errorf("expected max-age of a year, got %v", got)
+	}
+	if got := retryAfter(testNow, "99999999999"); got != 365*24*time.Hour {
+		t.Errorf("expected huge retry-after to be capped, got %v", got)
+	}
+}
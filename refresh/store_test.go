@@ -0,0 +1,132 @@
+package refresh
+
+import (
+	"database/sql"
+	"fmt"
+	"path/filepath"
+	"testing"
+
+	"github.com/3elDU/rss-reader-backend/database"
+	"github.com/jmoiron/sqlx"
+	"github.com/mmcdole/gofeed"
+)
+
+// Number of items in the benchmarked feed, of which only a few are new on each refresh
+const (
+	benchFeedItems = 50
+	benchNewItems  = 5
+)
+
+// benchTask creates a task with a database on disk, holding an archive of the given size
+func benchTask(b *testing.B, archive int) (*Task, database.Subscription) {
+	godb, err := database.NewWithMigrations(filepath.Join(b.TempDir(), "bench.sqlite"), "../database/migrations")
+	if err != nil {
+		b.Fatal(err)
+	}
+	db := sqlx.NewDb(godb, "sqlite")
+	b.Cleanup(func() { db.Close() })
+
+	t := NewTask(db, DefaultSchedule)
+
+	sub := database.Subscription{Type: "rss", Url: "https://example.com/rss.xml", Title: "Bench Feed"}
+	if err := t.sr.InsertSubscription(&sub); err != nil {
+		b.Fatal(err)
+	}
+
+	articles := []database.Article{}
+	for i := range archive {
+		articles = append(articles, database.Article{
+			SubscriptionId: sub.ID,
+			Url:            fmt.Sprintf("https://example.com/archive/%v", i),
+			Title:          "Archived",
+			Created:        benchCreated,
+			Guid:           fmt.Sprintf("archive-%v", i),
+		})
+	}
+	if _, _, err := t.ar.BulkAddArticles(articles); err != nil {
+		b.Fatal(err)
+	}
+
+	return t, sub
+}
+
+var benchCreated = sql.NullString{Valid: true, String: "2024-12-24 00:00:00"}
+
+// benchFeed returns the feed as it looks on the n-th refresh: the newest items are new, the rest were seen before
+func benchFeed(n int) *fetchResult {
+	items := []*gofeed.Item{}
+	for i := range benchFeedItems {
+		id := n*benchNewItems + i
+		items = append(items, &gofeed.Item{
+			GUID:  fmt.Sprintf("item-%v", id),
+			Link:  fmt.Sprintf("https://example.com/item/%v", id),
+			Title: "Item",
+		})
+	}
+
+	return &fetchResult{Feed: &gofeed.Feed{Items: items}}
+}
+
+// legacyStore is the write path that was used before: the whole archive is loaded and compared with each fetched item,
+// and the new articles are inserted one by one, outside of a transaction
+func (t *Task) legacyStore(sub database.Subscription, fr *fetchResult) (int, error) {
+	adb, err := t.ar.All()
+	if err != nil {
+		return 0, err
+	}
+
+	new := 0
+	for _, item := range fr.Feed.Items {
+		anew := database.Article{
+			SubscriptionId: sub.ID,
+			Url:            item.Link,
+			Title:          item.Title,
+			Created:        benchCreated,
+			Guid:           item.GUID,
+		}
+
+		exists := false
+		for _, aold := range adb {
+			if aold.SubscriptionId == anew.SubscriptionId && aold.Guid == anew.Guid {
+				exists = true
+				break
+			}
+		}
+
+		if !exists {
+			if err := t.ar.InsertArticle(&anew); err != nil {
+				return new, err
+			}
+			adb = append(adb, anew)
+			new++
+		}
+	}
+
+	return new, nil
+}
+
+func BenchmarkStore(b *testing.B) {
+	for _, archive := range []int{1000, 10000} {
+		b.Run(fmt.Sprintf("archive=%v/upsert", archive), func(b *testing.B) {
+			t, sub := benchTask(b, archive)
+			b.ResetTimer()
+
+			for n := range b.N {
+				if _, _, err := t.store(sub, benchFeed(n)); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+
+		b.Run(fmt.Sprintf("archive=%v/legacy", archive), func(b *testing.B) {
+			t, sub := benchTask(b, archive)
+			b.ResetTimer()
+
+			for n := range b.N {
+				if _, err := t.legacyStore(sub, benchFeed(n)); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
@@ -1,7 +1,9 @@
 package resource
 
 import (
+	"crypto/sha256"
 	"database/sql"
+	"encoding/hex"
 	"time"
 
 	"github.com/3elDU/rss-reader-backend/database"
@@ -9,25 +11,38 @@ import (
 )
 
 type Article struct {
-	Id             int64  `json:"id"`
-	SubscriptionId int64  `json:"subscriptionId"`
-	New            bool   `json:"new"`
-	Url            string `json:"url"`
-	Title          string `json:"title"`
-	Description    string `json:"description,omitempty"`
-	Thumbnail      string `json:"thumbnail,omitempty"`
-	// Time in time.DateTime format.
+	Id             int64 `json:"id"`
+	SubscriptionId int64 `json:"subscriptionId"`
+	// Whether the article is unread. Same as an empty ReadAt, kept for older clients.
+	New         bool   `json:"new"`
+	Url         string `json:"url"`
+	Title       string `json:"title"`
+	Description string `json:"description,omitempty"`
+	Thumbnail   string `json:"thumbnail,omitempty"`
+	// Time in time.DateTime format. Articles from feeds that don't specify it get the time when they were added.
 	Created   string `json:"created"`
 	ReadLater bool   `json:"readLater"`
 	// Time in time.DateTime format. Can be empty.
 	CreatedReadLater string `json:"createdReadLater,omitempty"`
+	// Stable identity of the article within its subscription.
+	// It's the GUID from the feed, or the link if there's no GUID, or a hash of the content if there's neither.
+	Guid string `json:"guid"`
+	// Time when the publisher last changed the article, in time.DateTime format. Empty if it was never changed.
+	UpdatedAt string `json:"updatedAt,omitempty"`
+	// Whether the article was shown to the user. Read articles are always seen.
+	Seen bool `json:"seen"`
+	// Time when the article was read, in time.DateTime format. Empty if it is unread.
+	ReadAt string `json:"readAt,omitempty"`
+	// Starred articles are kept permanently, unlike the read later list
+	Starred bool `json:"starred"`
+	// Time in time.DateTime format. Can be empty.
+	StarredAt string `json:"starredAt,omitempty"`
 }
 
 func (a Article) ToModel() database.Article {
 	return database.Article{
 		ID:             a.Id,
 		SubscriptionId: a.SubscriptionId,
-		New:            a.New,
 		Url:            a.Url,
 		Title:          a.Title,
 		Description: sql.NullString{
@@ -39,7 +54,7 @@ func (a Article) ToModel() database.Article {
 			String: a.Thumbnail,
 		},
 		Created: sql.NullString{
-			Valid:  true,
+			Valid:  a.Created != "",
 			String: a.Created,
 		},
 		ReadLater: a.ReadLater,
@@ -47,6 +62,21 @@ func (a Article) ToModel() database.Article {
 			Valid:  a.CreatedReadLater != "",
 			String: a.CreatedReadLater,
 		},
+		Guid: a.Guid,
+		UpdatedAt: sql.NullString{
+			Valid:  a.UpdatedAt != "",
+			String: a.UpdatedAt,
+		},
+		Seen: a.Seen,
+		ReadAt: sql.NullString{
+			Valid:  a.ReadAt != "",
+			String: a.ReadAt,
+		},
+		Starred: a.Starred,
+		StarredAt: sql.NullString{
+			Valid:  a.StarredAt != "",
+			String: a.StarredAt,
+		},
 	}
 }
 
@@ -54,7 +84,11 @@ func NewArticle(a database.Article) Article {
 	return Article{
 		Id:               a.ID,
 		SubscriptionId:   a.SubscriptionId,
-		New:              a.New,
+		New:              !a.ReadAt.Valid,
+		Seen:             a.Seen,
+		ReadAt:           a.ReadAt.String,
+		Starred:          a.Starred,
+		StarredAt:        a.StarredAt.String,
 		Url:              a.Url,
 		Title:            a.Title,
 		Description:      a.Description.String,
@@ -62,6 +96,8 @@ func NewArticle(a database.Article) Article {
 		Created:          a.Created.String,
 		ReadLater:        a.ReadLater,
 		CreatedReadLater: a.CreatedReadLater.String,
+		Guid:             a.Guid,
+		UpdatedAt:        a.UpdatedAt.String,
 	}
 }
 
@@ -71,7 +107,8 @@ func NewArticleFromGofeed(article gofeed.Item, subscriptionId int64) Article {
 		thmb = article.Image.URL
 	}
 
-	var c = time.Now().UTC().Format(time.DateTime)
+	// Left empty if the feed doesn't specify it, the database fills it in
+	var c string
 	if article.PublishedParsed != nil {
 		c = article.PublishedParsed.Format(time.DateTime)
 	}
@@ -86,9 +123,28 @@ func NewArticleFromGofeed(article gofeed.Item, subscriptionId int64) Article {
 		Created:          c,
 		ReadLater:        false,
 		CreatedReadLater: "",
+		Guid:             ArticleGuid(article),
 	}
 }
 
+// ArticleGuid returns the identity of the item within its feed.
+func ArticleGuid(item gofeed.Item) string {
+	if item.GUID != "" {
+		return item.GUID
+	}
+	if item.Link != "" {
+		return item.Link
+	}
+
+	// Neither is set, so the item can only be told apart by its content
+	h := sha256.New()
+	for _, s := range []string{item.Title, item.Description, item.Content} {
+		h.Write([]byte(s))
+		h.Write([]byte{0})
+	}
+	return "sha256:" + hex.EncodeToString(h.Sum(nil))
+}
+
 func NewArticlesFromGofeed(articles []*gofeed.Item, subscriptionId int64) (out []Article) {
 	for _, item := range articles {
 		out = append(out, NewArticleFromGofeed(*item, subscriptionId))
@@ -116,3 +172,16 @@ func NewArticleWithSubscriptionTwopart(a database.Article, s database.Subscripti
 		Subscription: NewSubscription(s),
 	}
 }
+
+type SearchResult struct {
+	ArticleWithSubscription
+	// Part of the article that matched the search query, with matches wrapped in <mark></mark>
+	Snippet string `json:"snippet"`
+}
+
+func NewSearchResult(r database.SearchResult) SearchResult {
+	return SearchResult{
+		ArticleWithSubscription: NewArticleWithSubscription(r.ArticleWithSubscription),
+		Snippet:                 r.Snippet,
+	}
+}
@@ -0,0 +1,22 @@
+package resource
+
+import "github.com/3elDU/rss-reader-backend/database"
+
+type Folder struct {
+	Id    int64  `json:"id,omitzero"`
+	Title string `json:"title"`
+}
+
+func (f Folder) ToModel() database.Folder {
+	return database.Folder{
+		ID:    f.Id,
+		Title: f.Title,
+	}
+}
+
+func NewFolder(m database.Folder) Folder {
+	return Folder{
+		Id:    m.ID,
+		Title: m.Title,
+	}
+}
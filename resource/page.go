@@ -0,0 +1,25 @@
+package resource
+
+import "github.com/3elDU/rss-reader-backend/database"
+
+// Page is the envelope for paginated listings.
+type Page[T any] struct {
+	Items []T `json:"items"`
+	// Cursor to pass in the "after" query parameter to get the next page. Empty on the last page.
+	Next string `json:"next,omitempty"`
+}
+
+func NewArticlePage(ams []database.ArticleWithSubscription, next *database.Cursor) Page[ArticleWithSubscription] {
+	p := Page[ArticleWithSubscription]{
+		Items: make([]ArticleWithSubscription, len(ams)),
+	}
+	for i, am := range ams {
+		p.Items[i] = NewArticleWithSubscription(am)
+	}
+
+	if next != nil {
+		p.Next = next.Encode()
+	}
+
+	return p
+}
@@ -0,0 +1,55 @@
+package resource
+
+import "github.com/3elDU/rss-reader-backend/database"
+
+type Revision struct {
+	// Number of the revision, starting from 1. The last revision is the current version of the article.
+	Revision    int    `json:"revision"`
+	Title       string `json:"title"`
+	Description string `json:"description,omitempty"`
+	// Since when this version was current, in time.DateTime format
+	Since string `json:"since"`
+	// When this version was replaced by the next one, in time.DateTime format. Empty for the current version.
+	ReplacedAt string `json:"replacedAt,omitempty"`
+}
+
+// Text returns the title and the description of the revision, in the form that is compared by the diff
+func (r Revision) Text() string {
+	return r.Title + "\n\n" + r.Description + "\n"
+}
+
+// NewRevisions returns the history of the article, with the current version as the last revision.
+func NewRevisions(a database.Article, revs []database.Revision) []Revision {
+	out := []Revision{}
+	for i, rev := range revs {
+		out = append(out, Revision{
+			Revision:    i + 1,
+			Title:       rev.Title,
+			Description: rev.Description.String,
+			Since:       rev.Since,
+			ReplacedAt:  rev.ReplacedAt,
+		})
+	}
+
+	since := a.Created.String
+	if a.UpdatedAt.Valid {
+		since = a.UpdatedAt.String
+	}
+
+	return append(out, Revision{
+		Revision:    len(revs) + 1,
+		Title:       a.Title,
+		Description: a.Description.String,
+		Since:       since,
+	})
+}
+
+type RevisionHistory struct {
+	ArticleId int64      `json:"articleId"`
+	Revisions []Revision `json:"revisions"`
+	// Revisions that are compared in the diff. Zero if there's only one revision.
+	From int `json:"from,omitempty"`
+	To   int `json:"to,omitempty"`
+	// Unified diff between the two revisions. Empty if they are the same.
+	Diff string `json:"diff,omitempty"`
+}
@@ -16,6 +16,25 @@ type Subscription struct {
 	Description string `json:"description,omitempty"`
 	// Thumbnail can be empty.
 	Thumbnail string `json:"thumbnail,omitempty"`
+	// Link to the website of the feed. Can be empty.
+	Link string `json:"link,omitempty"`
+	// Id of the folder the subscription is in. Zero if it isn't in any folder.
+	FolderId int64 `json:"folderId,omitempty"`
+
+	// Health of the feed. These fields are read-only, and are updated on each refresh.
+
+	// Time of the last successful refresh in time.DateTime format. Can be empty.
+	LastSuccessAt string `json:"lastSuccessAt,omitempty"`
+	// Time of the last refresh in time.DateTime format, successful or not. Can be empty.
+	LastAttemptAt string `json:"lastAttemptAt,omitempty"`
+	// Number of refreshes in a row that failed
+	FailureCount int64 `json:"failureCount,omitempty"`
+	// HTTP status of the last response. Zero if the feed didn't respond.
+	LastStatus int64 `json:"lastStatus,omitempty"`
+	// Error from the last refresh. Empty if it was successful.
+	LastError string `json:"lastError,omitempty"`
+	// When the feed will be fetched next, in time.DateTime format. Empty if it will be fetched on the next refresh.
+	NextRefreshAt string `json:"nextRefreshAt,omitempty"`
 }
 
 func (s Subscription) ToModel() database.Subscription {
@@ -32,6 +51,14 @@ func (s Subscription) ToModel() database.Subscription {
 			Valid:  s.Thumbnail != "",
 			String: s.Thumbnail,
 		},
+		Link: sql.NullString{
+			Valid:  s.Link != "",
+			String: s.Link,
+		},
+		FolderId: sql.NullInt64{
+			Valid: s.FolderId != 0,
+			Int64: s.FolderId,
+		},
 	}
 }
 
@@ -43,6 +70,15 @@ func NewSubscription(m database.Subscription) Subscription {
 		Title:       m.Title,
 		Description: m.Description.String,
 		Thumbnail:   m.Thumbnail.String,
+		Link:        m.Link.String,
+		FolderId:    m.FolderId.Int64,
+
+		LastSuccessAt: m.LastSuccessAt.String,
+		LastAttemptAt: m.LastAttemptAt.String,
+		FailureCount:  m.FailureCount,
+		LastStatus:    m.LastStatus.Int64,
+		LastError:     m.LastError.String,
+		NextRefreshAt: m.NextRefreshAt.String,
 	}
 }
 
@@ -58,5 +94,6 @@ func NewSubscriptionFromGofeed(feed gofeed.Feed) Subscription {
 		Title:       feed.Title,
 		Description: feed.Description,
 		Thumbnail:   t,
+		Link:        feed.Link,
 	}
 }
@@ -0,0 +1,60 @@
+package resource
+
+import (
+	"time"
+
+	"github.com/3elDU/rss-reader-backend/token"
+)
+
+type Token struct {
+	Id    int64  `json:"id"`
+	Label string `json:"label,omitempty"`
+	// The token itself. It is only shown once, when the token is created.
+	Token string `json:"token,omitempty"`
+	// Time in time.DateTime format.
+	CreatedAt string `json:"createdAt"`
+	// Time in time.DateTime format. Empty if the token never expires.
+	ValidUntil string `json:"validUntil,omitempty"`
+	// Permissions of the token, like ["read", "write"]
+	Scopes []token.Scope `json:"scopes"`
+	// Inactivity after which the token expires, in the Go duration format. Empty if the token only expires at ValidUntil.
+	IdleTimeout string `json:"idleTimeout,omitempty"`
+	// When and by which client the token was last used. Time in time.DateTime format, empty if the token was never used.
+	// Uses are recorded in batches, so this can lag behind by a bit.
+	LastUsedAt    string `json:"lastUsedAt,omitempty"`
+	LastIP        string `json:"lastIp,omitempty"`
+	LastUserAgent string `json:"lastUserAgent,omitempty"`
+	// Whether the token was replaced by a new one, and only works until ValidUntil
+	Rotated bool `json:"rotated,omitempty"`
+}
+
+// NewToken creates a resource without the token itself, so that it can be listed safely
+func NewToken(t token.Token) Token {
+	vu := ""
+	if !t.ValidUntil.IsZero() {
+		vu = t.ValidUntil.Format(time.DateTime)
+	}
+
+	it := ""
+	if t.IdleTimeout > 0 {
+		it = t.IdleTimeout.String()
+	}
+
+	lu := ""
+	if !t.LastUsedAt.IsZero() {
+		lu = t.LastUsedAt.Format(time.DateTime)
+	}
+
+	return Token{
+		Id:            t.ID,
+		Label:         t.Label,
+		CreatedAt:     t.CreatedAt.Format(time.DateTime),
+		ValidUntil:    vu,
+		Scopes:        t.Scopes,
+		IdleTimeout:   it,
+		LastUsedAt:    lu,
+		LastIP:        t.LastIP,
+		LastUserAgent: t.LastUserAgent,
+		Rotated:       t.Rotated,
+	}
+}
@@ -4,9 +4,15 @@ package server
 
 import (
 	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
 	"net/http"
 	"strconv"
+	"time"
 
+	"github.com/3elDU/rss-reader-backend/database"
+	"github.com/3elDU/rss-reader-backend/diff"
 	"github.com/3elDU/rss-reader-backend/resource"
 )
 
@@ -19,22 +25,23 @@ func (s *Server) getArticles(w http.ResponseWriter, r *http.Request) error {
 		return nil
 	}
 
-	adb, err := s.ar.ArticlesInSubscription(int64(id))
+	page, err := parsePage(r)
 	if err != nil {
-		return err
+		w.WriteHeader(http.StatusBadRequest)
+		return nil
 	}
 
-	sub, err := s.sr.Find(int64(id))
-	if err != nil {
+	// Respond with 404 if the subscription doesn't exist, instead of an empty list
+	if _, err := s.sr.FindForUser(userId(r), int64(id)); err != nil {
 		return err
 	}
 
-	a := make([]resource.ArticleWithSubscription, len(adb))
-	for i, adb := range adb {
-		a[i] = resource.NewArticleWithSubscriptionTwopart(adb, *sub)
+	adb, next, err := s.ar.ArticlesInSubscription(userId(r), int64(id), page)
+	if err != nil {
+		return err
 	}
 
-	enc, _ := json.Marshal(a)
+	enc, _ := json.Marshal(resource.NewArticlePage(adb, next))
 	w.Write(enc)
 	return nil
 }
@@ -47,35 +54,105 @@ func (s *Server) getSingleArticle(w http.ResponseWriter, r *http.Request) error
 		return nil
 	}
 
-	am, err := s.ar.Find(int64(id))
+	am, err := s.ar.FindForUser(userId(r), int64(id))
 	if err != nil {
 		return err
 	}
 
-	sm, err := s.sr.Find(am.SubscriptionId)
+	res := resource.NewArticleWithSubscription(*am)
+
+	encoded, _ := json.Marshal(res)
+	w.Write(encoded)
+	return nil
+}
+
+// getArticleRevisions responds with the history of the article, and a diff between two of its revisions.
+// The revisions are chosen with the "from" and "to" query parameters, and default to the previous and the current one.
+func (s *Server) getArticleRevisions(w http.ResponseWriter, r *http.Request) error {
+	id, err := strconv.Atoi(r.PathValue("id"))
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		return nil
+	}
+
+	am, err := s.ar.FindForUser(userId(r), int64(id))
 	if err != nil {
 		return err
 	}
 
-	res := resource.NewArticleWithSubscriptionTwopart(*am, *sm)
+	revs, err := s.ar.Revisions(am.ID)
+	if err != nil {
+		return err
+	}
+
+	res := resource.RevisionHistory{
+		ArticleId: am.ID,
+		Revisions: resource.NewRevisions(am.Article, revs),
+	}
+
+	n := len(res.Revisions)
+	query := r.URL.Query()
+	if query.Has("from") || query.Has("to") {
+		from, ferr := strconv.Atoi(query.Get("from"))
+		to, terr := strconv.Atoi(query.Get("to"))
+		if ferr != nil || terr != nil || from < 1 || from > n || to < 1 || to > n {
+			jsonError(w, http.StatusBadRequest, fmt.Sprintf("from and to must be revision numbers between 1 and %v", n))
+			return nil
+		}
+		res.From, res.To = from, to
+	} else if n > 1 {
+		res.From, res.To = n-1, n
+	}
+
+	if res.From != 0 {
+		from, to := res.Revisions[res.From-1], res.Revisions[res.To-1]
+		res.Diff = diff.Unified(
+			fmt.Sprintf("revision %v", from.Revision),
+			fmt.Sprintf("revision %v", to.Revision),
+			from.Text(), to.Text(),
+		)
+	}
 
 	encoded, _ := json.Marshal(res)
 	w.Write(encoded)
 	return nil
 }
 
+// getUnreadArticles responds with a page of unread articles.
+//
+// Query parameters:
+//   - folder: only articles from the subscriptions in the folder with this id
+//   - unseen: "true" to only show the articles that weren't shown to the user yet
 func (s *Server) getUnreadArticles(w http.ResponseWriter, r *http.Request) error {
-	unr, err := s.ar.Unread()
+	page, err := parsePage(r)
 	if err != nil {
-		return err
+		w.WriteHeader(http.StatusBadRequest)
+		return nil
+	}
+
+	f := database.UnreadFilter{}
+	q := r.URL.Query()
+
+	// Optionally, only show articles from the subscriptions in a folder
+	if v := q.Get("folder"); v != "" {
+		if f.FolderId, err = strconv.ParseInt(v, 10, 64); err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			return nil
+		}
+	}
+	if v := q.Get("unseen"); v != "" {
+		if f.Unseen, err = strconv.ParseBool(v); err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			return nil
+		}
 	}
 
-	ars := make([]resource.ArticleWithSubscription, len(unr))
-	for i, m := range unr {
-		ars[i] = resource.NewArticleWithSubscription(m)
+	unr, next, err := s.ar.Unread(userId(r), f, page)
+	if err != nil {
+		return err
 	}
 
-	encoded, _ := json.Marshal(ars)
+	encoded, _ := json.Marshal(resource.NewArticlePage(unr, next))
 	w.Write(encoded)
 	return nil
 }
@@ -87,14 +164,119 @@ func (s *Server) markArticleAsRead(w http.ResponseWriter, r *http.Request) error
 		return nil
 	}
 
-	article, err := s.ar.Find(int64(id))
+	article, err := s.ar.FindForUser(userId(r), int64(id))
 	if err != nil {
 		return nil
 	}
 
-	if err := s.ar.MarkRead(article); err != nil {
+	if err := s.ar.MarkRead(userId(r), &article.Article); err != nil {
 		return err
 	}
 
 	return nil
 }
+
+func (s *Server) markArticleAsUnread(w http.ResponseWriter, r *http.Request) error {
+	id, err := strconv.Atoi(r.PathValue("id"))
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		return nil
+	}
+
+	article, err := s.ar.FindForUser(userId(r), int64(id))
+	if err != nil {
+		return err
+	}
+
+	return s.ar.MarkUnread(userId(r), &article.Article)
+}
+
+func (s *Server) markArticleAsSeen(w http.ResponseWriter, r *http.Request) error {
+	id, err := strconv.Atoi(r.PathValue("id"))
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		return nil
+	}
+
+	article, err := s.ar.FindForUser(userId(r), int64(id))
+	if err != nil {
+		return err
+	}
+
+	return s.ar.MarkSeen(userId(r), &article.Article)
+}
+
+type MarkReadRequest struct {
+	// Ids of the articles to mark as read
+	Ids []int64 `json:"ids" validate:"max=1000"`
+	// Only mark the articles from this subscription
+	SubscriptionId int64 `json:"subscriptionId"`
+	// Only mark the articles from the subscriptions in this folder
+	FolderId int64 `json:"folderId"`
+	// Only mark the articles created before this time, either in RFC 3339 or in time.DateTime format
+	OlderThan string `json:"olderThan"`
+	// Only mark the articles matching this full-text search query
+	Query string `json:"query"`
+}
+
+type MarkReadResponse struct {
+	// Number of articles that were marked as read
+	Affected int64 `json:"affected"`
+}
+
+// markManyAsRead marks all unread articles matching the request as read.
+// The request must include the ids, the subscription or the date, so that everything isn't marked by accident.
+func (s *Server) markManyAsRead(w http.ResponseWriter, r *http.Request) error {
+	body := MarkReadRequest{}
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		log.Printf("invalid json: %v", err)
+		w.WriteHeader(http.StatusBadRequest)
+		return nil
+	}
+
+	if err := s.v.Struct(&body); err != nil {
+		log.Printf("validate error: %v", err)
+		w.WriteHeader(http.StatusBadRequest)
+		return nil
+	}
+
+	f := database.MarkReadFilter{
+		Ids:            body.Ids,
+		SubscriptionId: body.SubscriptionId,
+		FolderId:       body.FolderId,
+		Query:          body.Query,
+	}
+
+	if body.OlderThan != "" {
+		olderThan, err := parseTime(body.OlderThan)
+		if err != nil {
+			jsonError(w, http.StatusBadRequest, "olderThan must be in RFC 3339 or 'YYYY-MM-DD HH:MM:SS' format")
+			return nil
+		}
+		f.OlderThan = olderThan.UTC().Format(time.DateTime)
+	}
+
+	affected, err := s.ar.MarkManyRead(userId(r), f)
+	if errors.Is(err, database.ErrEmptyFilter) {
+		jsonError(w, http.StatusBadRequest, "ids, subscriptionId or olderThan is required")
+		return nil
+	} else if errors.Is(err, database.ErrEmptyQuery) {
+		jsonError(w, http.StatusBadRequest, "search query is empty")
+		return nil
+	} else if err != nil {
+		return err
+	}
+
+	enc, _ := json.Marshal(MarkReadResponse{affected})
+	w.Write(enc)
+	return nil
+}
+
+// parseTime accepts either an RFC 3339 time, or a time in time.DateTime format, which is assumed to be in UTC
+func parseTime(s string) (time.Time, error) {
+	if t, err := time.Parse(time.DateTime, s); err == nil {
+		return t, nil
+	}
+
+	return time.Parse(time.RFC3339, s)
+}
@@ -0,0 +1,210 @@
+// Password login routes
+
+package server
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"log"
+	"math"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/3elDU/rss-reader-backend/database"
+	"github.com/3elDU/rss-reader-backend/resource"
+	"github.com/3elDU/rss-reader-backend/token"
+)
+
+const (
+	// DefaultLoginValidFor is for how long the tokens issued by the login are valid, unless configured otherwise
+	DefaultLoginValidFor = 30 * 24 * time.Hour
+
+	// RotationGracePeriod is for how long the old token keeps working after it's rotated,
+	// so that the requests already in flight with it don't fail
+	RotationGracePeriod = time.Minute
+
+	// Failed logins in a row after which the user is locked out
+	maxFailedLogins = 5
+	// The first lockout lasts this long, and every further failed login doubles it, up to maxLockout
+	baseLockout = time.Minute
+	maxLockout  = time.Hour
+
+	// Failed logins after which a client address is refused for the rest of the window, whichever users it tried.
+	// This slows down guessing across many users, and locking the users out on purpose, from a single address.
+	maxClientFailedLogins    = 20
+	clientFailedLoginsWindow = 15 * time.Minute
+)
+
+type LoginRequest struct {
+	Name     string `json:"name" validate:"required"`
+	Password string `json:"password" validate:"required"`
+	// Name of the device the token is issued for, shown in the token list
+	Label string `json:"label" validate:"max=100"`
+	// For how long the token will be valid, in the Go duration format. Can't be longer than the configured expiry, which is the default.
+	ValidFor string `json:"validFor"`
+	// Inactivity after which the token expires, in the Go duration format. Can't be used together with ValidFor.
+	IdleTimeout string `json:"idleTimeout"`
+}
+
+// lockout returns for how long the logins are refused after the given number of failed logins in a row
+func lockout(failed int64) time.Duration {
+	if failed < maxFailedLogins {
+		return 0
+	}
+
+	// The shift is capped so that it doesn't overflow, the lockout is at its maximum long before that
+	return min(baseLockout<<min(failed-maxFailedLogins, 16), maxLockout)
+}
+
+// retryAfter tells the client when to try again
+func retryAfter(w http.ResponseWriter, until time.Time) {
+	w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(time.Until(until).Seconds()))))
+}
+
+// login checks the name and the password of the user, and responds with a new token for the device.
+// This is the only time the token itself is shown.
+func (s *Server) login(w http.ResponseWriter, r *http.Request) error {
+	body := LoginRequest{}
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		log.Printf("invalid json: %v", err)
+		w.WriteHeader(http.StatusBadRequest)
+		return nil
+	}
+
+	if err := s.v.Struct(&body); err != nil {
+		log.Printf("validate error: %v", err)
+		w.WriteHeader(http.StatusBadRequest)
+		return nil
+	}
+
+	validFor := s.LoginValidFor
+	if body.ValidFor != "" {
+		d, err := time.ParseDuration(body.ValidFor)
+		if err != nil || d <= 0 || d > s.LoginValidFor {
+			jsonError(w, http.StatusBadRequest, "validFor must be a positive duration, like \"720h\", no longer than "+s.LoginValidFor.String())
+			return nil
+		}
+		validFor = d
+	}
+
+	idleTimeout, ok := parseIdleTimeout(w, body.IdleTimeout, body.ValidFor != "")
+	if !ok {
+		return nil
+	}
+	if idleTimeout > s.LoginValidFor {
+		jsonError(w, http.StatusBadRequest, "idleTimeout can't be longer than "+s.LoginValidFor.String())
+		return nil
+	}
+
+	ip := clientIP(r)
+	if limited, until := s.failedLogins.exceeded(ip); limited {
+		retryAfter(w, until)
+		jsonError(w, http.StatusTooManyRequests, "too many failed logins from this address, try again later")
+		return nil
+	}
+
+	u, err := s.ur.FindByName(body.Name)
+	if err != nil && !errors.Is(err, sql.ErrNoRows) {
+		return err
+	}
+
+	// The password isn't even checked while the user is locked out, so that it can't be guessed in the meantime.
+	// Locked users are treated as unknown ones, because a different response would reveal which names exist.
+	// Since the lockout is keyed on the name, anyone who knows it can keep the user locked out,
+	// which is limited by the failed logins allowed per client address.
+	if u != nil && u.Locked(time.Now()) {
+		u = nil
+	}
+
+	// Unknown users get the same response as wrong passwords, so that the names can't be discovered
+	if !u.CheckPassword(body.Password) {
+		s.failedLogins.add(ip)
+
+		if u != nil {
+			failed, err := s.ur.RecordFailedLogin(u)
+			if err != nil {
+				return err
+			}
+			if d := lockout(failed); d > 0 {
+				if err := s.ur.LockUntil(u, time.Now().Add(d)); err != nil {
+					return err
+				}
+				log.Printf("user '%v' is locked out for %v after %v failed logins", u.Name, d, failed)
+			}
+		}
+
+		jsonError(w, http.StatusUnauthorized, "invalid name or password")
+		return nil
+	}
+
+	if u.FailedLogins > 0 {
+		if err := s.ur.ResetFailedLogins(u); err != nil {
+			return err
+		}
+	}
+
+	t := token.New(&validFor)
+	t.UserId = u.ID
+	t.Label = body.Label
+	if idleTimeout > 0 {
+		t.SetIdleTimeout(idleTimeout)
+	}
+
+	tm := t.ToModel()
+	if err := s.tr.Insert(&tm); err != nil {
+		return err
+	}
+	t.ID = tm.ID
+
+	res := resource.NewToken(*t)
+	res.Token = t.Token
+
+	enc, _ := json.Marshal(res)
+	w.WriteHeader(http.StatusCreated)
+	w.Write(enc)
+	return nil
+}
+
+// logout deletes the token the request was made with
+func (s *Server) logout(w http.ResponseWriter, r *http.Request) error {
+	t := r.Context().Value(token.TokenContextKey).(token.Token)
+	if err := s.tr.DeleteForUser(t.UserId, t.ID); err != nil {
+		return err
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+	return nil
+}
+
+// rotate replaces the token the request was made with by a new one, and responds with it.
+// The old token keeps working for RotationGracePeriod, and can't be rotated again.
+func (s *Server) rotate(w http.ResponseWriter, r *http.Request) error {
+	old := r.Context().Value(token.TokenContextKey).(token.Token)
+	if old.Rotated {
+		jsonError(w, http.StatusConflict, database.ErrAlreadyRotated.Error())
+		return nil
+	}
+
+	t := old.Replacement()
+	tm := t.ToModel()
+	graceUntil := time.Now().UTC().Add(RotationGracePeriod).Format(time.DateTime)
+
+	err := s.tr.Rotate(old.ID, graceUntil, &tm)
+	if errors.Is(err, database.ErrAlreadyRotated) {
+		jsonError(w, http.StatusConflict, err.Error())
+		return nil
+	} else if err != nil {
+		return err
+	}
+	t.ID = tm.ID
+
+	res := resource.NewToken(*t)
+	res.Token = t.Token
+
+	enc, _ := json.Marshal(res)
+	w.WriteHeader(http.StatusCreated)
+	w.Write(enc)
+	return nil
+}
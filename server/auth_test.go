@@ -0,0 +1,175 @@
+package server_test
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/3elDU/rss-reader-backend/database"
+	"github.com/3elDU/rss-reader-backend/server"
+	"github.com/jmoiron/sqlx"
+)
+
+func TestLogin(t *testing.T) {
+	ts, db := newIsolatedServer(t, nil)
+
+	ur := database.NewUserRepository(db)
+	u, err := ur.Find(database.DefaultUserId)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := ur.SetPassword(u, "correct horse"); err != nil {
+		t.Fatal(err)
+	}
+
+	defer EnableAuthForThisTest()()
+
+	// request sends a request with the given token, or without one if it's empty
+	request := func(tok, method, path, body string) (*http.Response, string) {
+		t.Helper()
+
+		req, err := http.NewRequest(method, ts.URL+path, strings.NewReader(body))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if tok != "" {
+			req.Header.Set("Authorization", "Bearer "+tok)
+		}
+
+		res, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer res.Body.Close()
+
+		b, _ := io.ReadAll(res.Body)
+		return res, string(b)
+	}
+
+	res, body := request("", "POST", "/auth/login", `{"name": "default", "password": "correct horse", "label": "phone", "validFor": "24h"}`)
+	if res.StatusCode != http.StatusCreated {
+		t.Fatalf("failed to log in: %v %v", res.StatusCode, body)
+	}
+	tok := struct {
+		Token      string   `json:"token"`
+		Label      string   `json:"label"`
+		ValidUntil string   `json:"validUntil"`
+		Scopes     []string `json:"scopes"`
+	}{}
+	if err := json.Unmarshal([]byte(body), &tok); err != nil {
+		t.Fatal(err)
+	}
+	if tok.Token == "" || tok.Label != "phone" || tok.ValidUntil == "" || len(tok.Scopes) != 3 {
+		t.Errorf("unexpected token: %v", body)
+	}
+
+	if res, body := request(tok.Token, "GET", "/ping", ""); res.StatusCode != http.StatusOK {
+		t.Errorf("token issued by the login doesn't work: %v %v", res.StatusCode, body)
+	}
+	if res, body := request(tok.Token, "POST", "/auth/logout", ""); res.StatusCode != http.StatusNoContent {
+		t.Errorf("failed to log out: %v %v", res.StatusCode, body)
+	}
+	if res, body := request(tok.Token, "GET", "/ping", ""); res.StatusCode != http.StatusUnauthorized {
+		t.Errorf("token still works after the logout: %v %v", res.StatusCode, body)
+	}
+
+	requests := []struct {
+		name   string
+		body   string
+		status int
+	}{
+		{"missing password", `{"name": "default"}`, 400},
+		{"validFor longer than the expiry", `{"name": "default", "password": "correct horse", "validFor": "8760h"}`, 400},
+		{"unknown user", `{"name": "nobody", "password": "correct horse"}`, 401},
+	}
+	for _, r := range requests {
+		if res, body := request("", "POST", "/auth/login", r.body); res.StatusCode != r.status {
+			t.Errorf("%v: bad http status code: want %v, got %v %v", r.name, r.status, res.StatusCode, body)
+		}
+	}
+
+	// After too many failed logins even the right password is refused, the same way as a wrong one
+	for i := range 5 {
+		if res, body := request("", "POST", "/auth/login", `{"name": "default", "password": "wrong"}`); res.StatusCode != http.StatusUnauthorized {
+			t.Errorf("failed login %v: bad http status code: want 401, got %v %v", i+1, res.StatusCode, body)
+		}
+	}
+	res, body = request("", "POST", "/auth/login", `{"name": "default", "password": "correct horse"}`)
+	if res.StatusCode != http.StatusUnauthorized || res.Header.Get("Retry-After") != "" || !strings.Contains(body, "invalid name or password") {
+		t.Errorf("user was not locked out like an unknown user: %v %v %v", res.StatusCode, res.Header, body)
+	}
+
+	// Setting the password lifts the lockout
+	if err := ur.SetPassword(u, "battery staple"); err != nil {
+		t.Fatal(err)
+	}
+	if res, body := request("", "POST", "/auth/login", `{"name": "default", "password": "battery staple"}`); res.StatusCode != http.StatusCreated {
+		t.Errorf("failed to log in after the password was reset: %v %v", res.StatusCode, body)
+	}
+}
+
+func TestConcurrentFailedLogins(t *testing.T) {
+	// Concurrent requests need a database shared by all the connections, unlike the in-memory one
+	godb, err := database.NewWithMigrations(filepath.Join(t.TempDir(), "logins.sqlite"), "../database/migrations")
+	if err != nil {
+		t.Fatal(err)
+	}
+	db := sqlx.NewDb(godb, "sqlite")
+	defer db.Close()
+
+	ts := httptest.NewServer(server.NewServer(db, nil))
+	defer ts.Close()
+
+	ur := database.NewUserRepository(db)
+	u, err := ur.Find(database.DefaultUserId)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := ur.SetPassword(u, "correct horse"); err != nil {
+		t.Fatal(err)
+	}
+
+	login := func(body string) int {
+		res, err := http.Post(ts.URL+"/auth/login", "application/json", strings.NewReader(body))
+		if err != nil {
+			t.Error(err)
+			return 0
+		}
+		res.Body.Close()
+		return res.StatusCode
+	}
+
+	// Guesses made at the same time are all counted, so they can't get around the lockout
+	var wg sync.WaitGroup
+	for range 5 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			login(`{"name": "default", "password": "wrong"}`)
+		}()
+	}
+	wg.Wait()
+
+	if u, err := ur.Find(database.DefaultUserId); err != nil || u.FailedLogins != 5 {
+		t.Errorf("expected 5 failed logins, got %+v %v", u, err)
+	}
+	if status := login(`{"name": "default", "password": "correct horse"}`); status != http.StatusUnauthorized {
+		t.Errorf("user was not locked out: want 401, got %v", status)
+	}
+
+	// The client is refused after too many failed logins, whichever users it tries
+	for i := range 14 {
+		if status := login(fmt.Sprintf(`{"name": "user%v", "password": "wrong"}`, i)); status != http.StatusUnauthorized {
+			t.Errorf("failed login %v: want 401, got %v", i+1, status)
+		}
+	}
+	if status := login(`{"name": "user14", "password": "wrong"}`); status != http.StatusTooManyRequests {
+		t.Errorf("client was not limited: want 429, got %v", status)
+	}
+}
@@ -0,0 +1,211 @@
+// Folder-related routes
+
+package server
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"strconv"
+
+	"github.com/3elDU/rss-reader-backend/database"
+	"github.com/3elDU/rss-reader-backend/resource"
+)
+
+type FolderRequest struct {
+	Title string `json:"title" validate:"required"`
+}
+
+func (s *Server) getFolders(w http.ResponseWriter, r *http.Request) error {
+	fms, err := s.fr.All(userId(r))
+	if err != nil {
+		return err
+	}
+
+	frs := make([]resource.Folder, len(fms))
+	for i, fm := range fms {
+		frs[i] = resource.NewFolder(fm)
+	}
+
+	enc, _ := json.Marshal(frs)
+	w.Write(enc)
+	return nil
+}
+
+func (s *Server) getSingleFolder(w http.ResponseWriter, r *http.Request) error {
+	id, err := strconv.Atoi(r.PathValue("id"))
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		return nil
+	}
+
+	fm, err := s.fr.Find(userId(r), int64(id))
+	if err != nil {
+		return err
+	}
+
+	enc, _ := json.Marshal(resource.NewFolder(*fm))
+	w.Write(enc)
+	return nil
+}
+
+func (s *Server) createFolder(w http.ResponseWriter, r *http.Request) error {
+	body := FolderRequest{}
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		log.Printf("invalid json: %v", err)
+		w.WriteHeader(http.StatusBadRequest)
+		return nil
+	}
+
+	if err := s.v.Struct(&body); err != nil {
+		log.Printf("validate error: %v", err)
+		w.WriteHeader(http.StatusBadRequest)
+		return nil
+	}
+
+	if taken, err := s.folderTitleTaken(userId(r), body.Title, 0); err != nil {
+		return err
+	} else if taken {
+		jsonError(w, http.StatusConflict, "folder with this title already exists")
+		return nil
+	}
+
+	fr := resource.Folder{Title: body.Title}
+	fm := fr.ToModel()
+	fm.UserId = userId(r)
+	if err := s.fr.Insert(&fm); err != nil {
+		return err
+	}
+	fr.Id = fm.ID
+
+	enc, _ := json.Marshal(fr)
+	w.WriteHeader(http.StatusCreated)
+	w.Write(enc)
+	return nil
+}
+
+func (s *Server) updateFolder(w http.ResponseWriter, r *http.Request) error {
+	id, err := strconv.Atoi(r.PathValue("id"))
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		return nil
+	}
+
+	body := FolderRequest{}
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		log.Printf("invalid json: %v", err)
+		w.WriteHeader(http.StatusBadRequest)
+		return nil
+	}
+
+	if err := s.v.Struct(&body); err != nil {
+		log.Printf("validate error: %v", err)
+		w.WriteHeader(http.StatusBadRequest)
+		return nil
+	}
+
+	fm, err := s.fr.Find(userId(r), int64(id))
+	if err != nil {
+		return err
+	}
+
+	if taken, err := s.folderTitleTaken(userId(r), body.Title, fm.ID); err != nil {
+		return err
+	} else if taken {
+		jsonError(w, http.StatusConflict, "folder with this title already exists")
+		return nil
+	}
+
+	fm.Title = body.Title
+	if err := s.fr.Update(*fm); err != nil {
+		return err
+	}
+
+	enc, _ := json.Marshal(resource.NewFolder(*fm))
+	w.Write(enc)
+	return nil
+}
+
+func (s *Server) deleteFolder(w http.ResponseWriter, r *http.Request) error {
+	id, err := strconv.Atoi(r.PathValue("id"))
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		return nil
+	}
+
+	if err := s.fr.Delete(userId(r), int64(id)); err != nil {
+		return err
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+	return nil
+}
+
+func (s *Server) getFolderArticles(w http.ResponseWriter, r *http.Request) error {
+	id, err := strconv.Atoi(r.PathValue("id"))
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		return nil
+	}
+
+	page, err := parsePage(r)
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		return nil
+	}
+
+	// Respond with 404 if the folder doesn't exist, instead of an empty list
+	if _, err := s.fr.Find(userId(r), int64(id)); err != nil {
+		return err
+	}
+
+	ams, next, err := s.ar.ArticlesInFolder(userId(r), int64(id), page)
+	if err != nil {
+		return err
+	}
+
+	enc, _ := json.Marshal(resource.NewArticlePage(ams, next))
+	w.Write(enc)
+	return nil
+}
+
+// folderTitleTaken checks whether a folder of the user other than the one with the given id already has this title.
+func (s *Server) folderTitleTaken(userId int64, title string, id int64) (bool, error) {
+	fm, err := s.fr.FindByTitle(userId, title)
+	if errors.Is(err, sql.ErrNoRows) {
+		return false, nil
+	} else if err != nil {
+		return false, err
+	}
+
+	return fm.ID != id, nil
+}
+
+// folderExists reports whether the user has a folder with the given id.
+func (s *Server) folderExists(userId, id int64) (bool, error) {
+	_, err := s.fr.Find(userId, id)
+	if errors.Is(err, sql.ErrNoRows) {
+		return false, nil
+	}
+
+	return err == nil, err
+}
+
+// findOrCreateFolder returns the folder of the user with the given title, creating it if it doesn't exist yet.
+func (s *Server) findOrCreateFolder(userId int64, title string) (int64, error) {
+	fm, err := s.fr.FindByTitle(userId, title)
+	if err == nil {
+		return fm.ID, nil
+	} else if !errors.Is(err, sql.ErrNoRows) {
+		return 0, err
+	}
+
+	fm = &database.Folder{UserId: userId, Title: title}
+	if err := s.fr.Insert(fm); err != nil {
+		return 0, err
+	}
+
+	return fm.ID, nil
+}
@@ -0,0 +1,100 @@
+package server_test
+
+import (
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestFolderRoutes(t *testing.T) {
+	ts, _ := newIsolatedServer(t, map[string]mockResponse{
+		"https://example.com/rss.xml": {200, `<?xml version="1.0" encoding="UTF-8"?>
+			<rss version="2.0">
+				<channel>
+					<title>Test Feed</title>
+					<item>
+						<title>Test Article</title>
+						<pubDate>Tue, 24 Dec 2024 00:00:00 +0000</pubDate>
+						<link>https://example.com/test-article</link>
+					</item>
+				</channel>
+			</rss>`,
+		},
+		"https://example.com/other.xml": {200, `<?xml version="1.0" encoding="UTF-8"?>
+			<rss version="2.0">
+				<channel>
+					<title>Other Feed</title>
+					<item>
+						<title>Other Article</title>
+						<pubDate>Wed, 25 Dec 2024 00:00:00 +0000</pubDate>
+						<link>https://example.com/other-article</link>
+					</item>
+				</channel>
+			</rss>`,
+		},
+	})
+
+	testArticle := `{"id":1,"subscriptionId":1,"new":true,"url":"https://example.com/test-article","title":"Test Article","created":"2024-12-24 00:00:00","readLater":false,"guid":"https://example.com/test-article","seen":false,"starred":false,` +
+		`"subscription":{"id":1,"type":"rss","url":"https://example.com/rss.xml","title":"Test Feed","folderId":1}}`
+
+	tests := []struct {
+		name       string
+		method     string
+		path       string
+		body       string
+		statusCode int
+		response   string
+	}{
+		{"create folder", "POST", "/folders", `{"title": "News"}`, 201, `{"id":1,"title":"News"}`},
+		{"create folder without title", "POST", "/folders", `{}`, 400, ``},
+		{"create folder with taken title", "POST", "/folders", `{"title": "News"}`, 409, `{"error":true,"message":"folder with this title already exists"}`},
+		{"create another folder", "POST", "/folders", `{"title": "Blogs"}`, 201, `{"id":2,"title":"Blogs"}`},
+		{"rename folder", "PATCH", "/folders/2", `{"title": "Personal blogs"}`, 200, `{"id":2,"title":"Personal blogs"}`},
+		{"rename folder to taken title", "PATCH", "/folders/2", `{"title": "News"}`, 409, `{"error":true,"message":"folder with this title already exists"}`},
+		{"list folders", "GET", "/folders", ``, 200, `[{"id":1,"title":"News"},{"id":2,"title":"Personal blogs"}]`},
+		{"get folder", "GET", "/folders/1", ``, 200, `{"id":1,"title":"News"}`},
+		{"get missing folder", "GET", "/folders/3", ``, 404, ``},
+		{
+			"subscribe into folder", "POST", "/subscribe", `{"url": "https://example.com/rss.xml", "folderId": 1}`, 201,
+			`{"id":1,"type":"rss","url":"https://example.com/rss.xml","title":"Test Feed","folderId":1}`,
+		},
+		{"subscribe into missing folder", "POST", "/subscribe", `{"url": "https://example.com/other.xml", "folderId": 3}`, 400, `{"error":true,"message":"folder does not exist"}`},
+		{
+			"subscribe outside of folders", "POST", "/subscribe", `{"url": "https://example.com/other.xml"}`, 201,
+			`{"id":2,"type":"rss","url":"https://example.com/other.xml","title":"Other Feed"}`,
+		},
+		{"articles in folder", "GET", "/folders/1/articles", ``, 200, `{"items":[` + testArticle + `]}`},
+		{"unread articles in folder", "GET", "/unread?folder=1", ``, 200, `{"items":[` + testArticle + `]}`},
+		{"unread articles in empty folder", "GET", "/unread?folder=2", ``, 200, `{"items":[]}`},
+		{"articles in missing folder", "GET", "/folders/3/articles", ``, 404, ``},
+		{
+			"move subscription to another folder", "PATCH", "/subscriptions/2", `{"folderId": 2}`, 200,
+			`{"id":2,"type":"rss","url":"https://example.com/other.xml","title":"Other Feed","folderId":2}`,
+		},
+		{"move subscription to missing folder", "PATCH", "/subscriptions/2", `{"folderId": 3}`, 400, `{"error":true,"message":"folder does not exist"}`},
+		{
+			"remove subscription from folder", "PATCH", "/subscriptions/2", `{"folderId": 0}`, 200,
+			`{"id":2,"type":"rss","url":"https://example.com/other.xml","title":"Other Feed"}`,
+		},
+		{"delete folder", "DELETE", "/folders/1", ``, 204, ``},
+		{"delete missing folder", "DELETE", "/folders/1", ``, 404, ``},
+		{
+			"subscriptions are kept when their folder is deleted", "GET", "/subscriptions/1", ``, 200,
+			`{"id":1,"type":"rss","url":"https://example.com/rss.xml","title":"Test Feed"}`,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			status, body := doRequest(t, test.method, ts.URL+test.path, test.body)
+
+			if status != test.statusCode {
+				t.Errorf("bad http status code: want %v, got %v", test.statusCode, status)
+			}
+
+			if diff := cmp.Diff(test.response, body); diff != "" {
+				t.Errorf("unexpected response body (-want +got):\n%v", diff)
+			}
+		})
+	}
+}
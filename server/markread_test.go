@@ -0,0 +1,115 @@
+package server_test
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"testing"
+)
+
+func TestMarkManyRead(t *testing.T) {
+	mocked := map[string]mockResponse{
+		"https://example.com/rss.xml": {200, `<?xml version="1.0" encoding="UTF-8"?>
+			<rss version="2.0">
+				<channel>
+					<title>Test Feed</title>
+					<item>
+						<title>Old news</title>
+						<link>https://example.com/old</link>
+						<pubDate>Mon, 01 Jan 2024 00:00:00 GMT</pubDate>
+					</item>
+					<item>
+						<title>Recent news</title>
+						<link>https://example.com/recent</link>
+						<pubDate>Tue, 24 Dec 2024 00:00:00 GMT</pubDate>
+					</item>
+				</channel>
+			</rss>`,
+		},
+		"https://example.com/other.xml": {200, `<?xml version="1.0" encoding="UTF-8"?>
+			<rss version="2.0">
+				<channel>
+					<title>Other Feed</title>
+					<item>
+						<title>Old cooking recipe</title>
+						<link>https://example.com/recipe</link>
+						<pubDate>Mon, 01 Jan 2024 00:00:00 GMT</pubDate>
+					</item>
+				</channel>
+			</rss>`,
+		},
+	}
+
+	tests := []struct {
+		name     string
+		body     string
+		status   int
+		response string
+		// Number of articles that are still unread afterwards
+		unread int
+	}{
+		{"ids", `{"ids": [1, 3]}`, http.StatusOK, `{"affected":2}`, 1},
+		{"subscription", `{"subscriptionId": 1}`, http.StatusOK, `{"affected":2}`, 1},
+		{"older than", `{"olderThan": "2024-06-01 00:00:00"}`, http.StatusOK, `{"affected":2}`, 1},
+		{"older than rfc 3339", `{"olderThan": "2024-06-01T03:00:00+03:00"}`, http.StatusOK, `{"affected":2}`, 1},
+		{"older than in folder", `{"olderThan": "2024-06-01 00:00:00", "folderId": 1}`, http.StatusOK, `{"affected":1}`, 2},
+		{"search in subscription", `{"subscriptionId": 1, "query": "recent"}`, http.StatusOK, `{"affected":1}`, 2},
+		{"search only", `{"query": "news"}`, http.StatusBadRequest, `{"error":true,"message":"ids, subscriptionId or olderThan is required"}`, 3},
+		{"empty", `{}`, http.StatusBadRequest, `{"error":true,"message":"ids, subscriptionId or olderThan is required"}`, 3},
+		{"invalid date", `{"olderThan": "yesterday"}`, http.StatusBadRequest, `{"error":true,"message":"olderThan must be in RFC 3339 or 'YYYY-MM-DD HH:MM:SS' format"}`, 3},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			ts, _ := newIsolatedServer(t, mocked)
+
+			if status, body := doRequest(t, "POST", ts.URL+"/folders", `{"title": "News"}`); status != http.StatusCreated {
+				t.Fatalf("failed to create folder: %v %v", status, body)
+			}
+			for _, feed := range []string{`{"url": "https://example.com/rss.xml", "folderId": 1}`, `{"url": "https://example.com/other.xml"}`} {
+				if status, body := doRequest(t, "POST", ts.URL+"/subscribe", feed); status != http.StatusCreated {
+					t.Fatalf("failed to subscribe: %v %v", status, body)
+				}
+			}
+
+			status, body := doRequest(t, "POST", ts.URL+"/markread", test.body)
+			if status != test.status || body != test.response {
+				t.Errorf("unexpected response: want %v %v, got %v %v", test.status, test.response, status, body)
+			}
+
+			status, body = doRequest(t, "GET", ts.URL+"/unread", "")
+			if status != http.StatusOK {
+				t.Fatalf("bad http status code: want 200, got %v %v", status, body)
+			}
+			if got := countItems(t, body); got != test.unread {
+				t.Errorf("expected %v unread articles, got %v", test.unread, got)
+			}
+		})
+	}
+
+	// Articles that are already read are not counted again
+	ts, _ := newIsolatedServer(t, mocked)
+	if status, body := doRequest(t, "POST", ts.URL+"/subscribe", `{"url": "https://example.com/rss.xml"}`); status != http.StatusCreated {
+		t.Fatalf("failed to subscribe: %v %v", status, body)
+	}
+	for i, want := range []int{2, 0} {
+		_, body := doRequest(t, "POST", ts.URL+"/markread", `{"subscriptionId": 1}`)
+		if body != fmt.Sprintf(`{"affected":%v}`, want) {
+			t.Errorf("request %v: expected %v affected articles, got %v", i+1, want, body)
+		}
+	}
+}
+
+// countItems returns the number of items on the page in the response body
+func countItems(t *testing.T, body string) int {
+	t.Helper()
+
+	p := struct {
+		Items []json.RawMessage `json:"items"`
+	}{}
+	if err := json.Unmarshal([]byte(body), &p); err != nil {
+		t.Fatalf("failed to decode response: %v", err)
+	}
+
+	return len(p.Items)
+}
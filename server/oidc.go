@@ -0,0 +1,250 @@
+// OpenID Connect login routes
+
+package server
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"crypto/subtle"
+	"database/sql"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/3elDU/rss-reader-backend/database"
+	"github.com/3elDU/rss-reader-backend/middleware"
+	"github.com/3elDU/rss-reader-backend/oidc"
+	"github.com/3elDU/rss-reader-backend/resource"
+	"github.com/3elDU/rss-reader-backend/token"
+)
+
+const (
+	// How long the user has to log in at the provider
+	oidcLoginTimeout = 10 * time.Minute
+	// Cookie that binds the login to the browser that started it
+	oidcLoginCookie = "oidc_login"
+)
+
+// oidcLogin is what's needed to finish the login when the provider sends the user back.
+// It's kept in an encrypted cookie, so that the server holds nothing for the logins that were never finished.
+type oidcLogin struct {
+	State    string `json:"state"`
+	Nonce    string `json:"nonce"`
+	Verifier string `json:"verifier"`
+	Label    string `json:"label"`
+	Expires  int64  `json:"expires"`
+}
+
+// seal encrypts the login, so that it can't be read or changed by the client
+func (s *Server) sealLogin(l oidcLogin) string {
+	plain, _ := json.Marshal(l)
+
+	nonce := make([]byte, s.loginCipher.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		panic(err)
+	}
+
+	return base64.RawURLEncoding.EncodeToString(s.loginCipher.Seal(nonce, nonce, plain, nil))
+}
+
+// openLogin decrypts the login sealed by sealLogin, and checks that it hasn't expired
+func (s *Server) openLogin(sealed string) (*oidcLogin, error) {
+	b, err := base64.RawURLEncoding.DecodeString(sealed)
+	if err != nil || len(b) < s.loginCipher.NonceSize() {
+		return nil, errors.New("malformed login cookie")
+	}
+
+	n := s.loginCipher.NonceSize()
+	plain, err := s.loginCipher.Open(nil, b[:n], b[n:], nil)
+	if err != nil {
+		return nil, errors.New("login cookie was not issued by this server")
+	}
+
+	l := &oidcLogin{}
+	if err := json.Unmarshal(plain, l); err != nil {
+		return nil, err
+	}
+	if time.Now().After(time.Unix(l.Expires, 0)) {
+		return nil, errors.New("login expired")
+	}
+
+	return l, nil
+}
+
+// setLoginCookie sets the cookie with the sealed login, or deletes it when the value is empty
+func (s *Server) setLoginCookie(w http.ResponseWriter, value string) {
+	maxAge := int(oidcLoginTimeout.Seconds())
+	if value == "" {
+		maxAge = -1
+	}
+
+	http.SetCookie(w, &http.Cookie{
+		Name:     oidcLoginCookie,
+		Value:    value,
+		Path:     "/auth/oidc/",
+		MaxAge:   maxAge,
+		HttpOnly: true,
+		Secure:   strings.HasPrefix(s.oidc.RedirectURL, "https://"),
+		// The provider sends the user back with a top-level navigation, which lax cookies are sent with
+		SameSite: http.SameSiteLaxMode,
+	})
+}
+
+// EnableOIDC registers the routes for logging in through the OpenID Connect provider.
+// Users that log in for the first time get a new account. Tokens issued this way work like any other.
+func (s *Server) EnableOIDC(p *oidc.Provider) {
+	s.oidc = p
+
+	// The logins in progress are encrypted with a key that only lives as long as the server,
+	// so they have to be started over after a restart
+	key := make([]byte, 32)
+	if _, err := rand.Read(key); err != nil {
+		panic(err)
+	}
+	block, _ := aes.NewCipher(key)
+	s.loginCipher, _ = cipher.NewGCM(block)
+
+	// Those are visited by the browser of the user, before there's a token
+	s.Handle("GET /auth/oidc/login", middleware.Error(s.oidcLogin))
+	s.Handle("GET /auth/oidc/callback", middleware.Json(middleware.Error(s.oidcCallback)))
+}
+
+// oidcLogin sends the user to the provider to log in. The label query parameter becomes the label of the token.
+func (s *Server) oidcLogin(w http.ResponseWriter, r *http.Request) error {
+	label := r.URL.Query().Get("label")
+	if len(label) > 100 {
+		jsonError(w, http.StatusBadRequest, "label can't be longer than 100 characters")
+		return nil
+	}
+
+	l := oidcLogin{
+		State:    oidc.RandomString(),
+		Nonce:    oidc.RandomString(),
+		Verifier: oidc.RandomString(),
+		Label:    label,
+		Expires:  time.Now().Add(oidcLoginTimeout).Unix(),
+	}
+	s.setLoginCookie(w, s.sealLogin(l))
+
+	http.Redirect(w, r, s.oidc.AuthURL(l.State, l.Nonce, oidc.Challenge(l.Verifier)), http.StatusFound)
+	return nil
+}
+
+// oidcCallback finishes the login when the provider sends the user back, and responds with a new token.
+// This is the only time the token itself is shown.
+func (s *Server) oidcCallback(w http.ResponseWriter, r *http.Request) error {
+	q := r.URL.Query()
+
+	// The login has to be finished by the browser that started it, which has the cookie with the same state.
+	// Otherwise someone could make the user finish a login that they started, and use the account they logged into.
+	c, err := r.Cookie(oidcLoginCookie)
+	if err != nil {
+		jsonError(w, http.StatusBadRequest, "the login wasn't started in this browser, start over")
+		return nil
+	}
+	s.setLoginCookie(w, "")
+
+	l, err := s.openLogin(c.Value)
+	if err != nil {
+		log.Printf("oidc: %v", err)
+		jsonError(w, http.StatusBadRequest, "unknown or expired login, start over")
+		return nil
+	}
+	if subtle.ConstantTimeCompare([]byte(l.State), []byte(q.Get("state"))) != 1 {
+		jsonError(w, http.StatusBadRequest, "the login wasn't started in this browser, start over")
+		return nil
+	}
+
+	if e := q.Get("error"); e != "" {
+		log.Printf("oidc: provider refused the login: %v %v", e, q.Get("error_description"))
+		jsonError(w, http.StatusUnauthorized, "login failed: "+e)
+		return nil
+	}
+
+	raw, err := s.oidc.Exchange(r.Context(), q.Get("code"), l.Verifier)
+	if err != nil {
+		log.Printf("oidc: code exchange failed: %v", err)
+		jsonError(w, http.StatusUnauthorized, "login failed")
+		return nil
+	}
+
+	claims, err := s.oidc.Verify(r.Context(), raw, l.Nonce)
+	if err != nil {
+		log.Printf("oidc: %v", err)
+		jsonError(w, http.StatusUnauthorized, "login failed")
+		return nil
+	}
+
+	u, err := s.ur.FindByIdentity(claims.Issuer, claims.Subject)
+	if errors.Is(err, sql.ErrNoRows) {
+		u, err = s.createOIDCUser(claims)
+	}
+	if err != nil {
+		return err
+	}
+
+	label := l.Label
+	if label == "" {
+		label = "OpenID Connect"
+	}
+
+	t := token.New(&s.LoginValidFor)
+	t.UserId = u.ID
+	t.Label = label
+
+	tm := t.ToModel()
+	if err := s.tr.Insert(&tm); err != nil {
+		return err
+	}
+	t.ID = tm.ID
+
+	res := resource.NewToken(*t)
+	res.Token = t.Token
+
+	enc, _ := json.Marshal(res)
+	w.WriteHeader(http.StatusCreated)
+	w.Write(enc)
+	return nil
+}
+
+// createOIDCUser creates the user for the account at the provider, named after its username or email if they are free.
+// Existing users are never taken over by name, since anyone could have that name at the provider.
+func (s *Server) createOIDCUser(c *oidc.Claims) (*database.User, error) {
+	host := c.Issuer
+	if u, err := url.Parse(c.Issuer); err == nil && u.Host != "" {
+		host = u.Host
+	}
+
+	for _, name := range []string{c.PreferredUsername, c.Email, fmt.Sprintf("%v@%v", c.Subject, host)} {
+		if name == "" {
+			continue
+		}
+
+		_, err := s.ur.FindByName(name)
+		if err == nil {
+			continue
+		} else if !errors.Is(err, sql.ErrNoRows) {
+			return nil, err
+		}
+
+		// Another login of the same account can create the user first, and then that user is the one to log in
+		u := &database.User{Name: name}
+		if err := s.ur.InsertWithIdentity(u, c.Issuer, c.Subject); errors.Is(err, database.ErrIdentityTaken) {
+			return s.ur.FindByIdentity(c.Issuer, c.Subject)
+		} else if err != nil {
+			return nil, err
+		}
+		log.Printf("oidc: created user '%v' for subject '%v'", name, c.Subject)
+
+		return u, nil
+	}
+
+	return nil, fmt.Errorf("no free user name for subject '%v'", c.Subject)
+}
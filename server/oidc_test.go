@@ -0,0 +1,162 @@
+package server_test
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/cookiejar"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/3elDU/rss-reader-backend/database"
+	"github.com/3elDU/rss-reader-backend/oidc"
+	"github.com/3elDU/rss-reader-backend/oidc/oidctest"
+	"github.com/3elDU/rss-reader-backend/server"
+	"github.com/jmoiron/sqlx"
+)
+
+func TestOIDCLogin(t *testing.T) {
+	godb, err := database.NewWithMigrations(":memory:", "../database/migrations")
+	if err != nil {
+		t.Fatal(err)
+	}
+	db := sqlx.NewDb(godb, "sqlite")
+	defer db.Close()
+
+	s := server.NewServer(db, nil)
+	ts := httptest.NewServer(s)
+	defer ts.Close()
+
+	fake := oidctest.NewProvider("rss-reader")
+	defer fake.Close()
+	fake.PreferredUsername = "alice"
+
+	provider, err := oidc.Discover(context.Background(), oidc.Config{
+		Issuer:      fake.Issuer(),
+		ClientID:    "rss-reader",
+		RedirectURL: ts.URL + "/auth/oidc/callback",
+	}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	s.EnableOIDC(provider)
+
+	defer EnableAuthForThisTest()()
+
+	// newBrowser returns a client that keeps cookies, and doesn't follow redirects so that they can be followed by hand
+	newBrowser := func() *http.Client {
+		jar, err := cookiejar.New(nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return &http.Client{
+			Jar: jar,
+			CheckRedirect: func(*http.Request, []*http.Request) error {
+				return http.ErrUseLastResponse
+			},
+		}
+	}
+	client := newBrowser()
+	get := func(url string) *http.Response {
+		t.Helper()
+
+		res, err := client.Get(url)
+		if err != nil {
+			t.Fatal(err)
+		}
+		t.Cleanup(func() { res.Body.Close() })
+		return res
+	}
+
+	// login goes through the whole flow, and returns the issued token along with the url of the callback
+	login := func() (tok struct {
+		Token string `json:"token"`
+		Label string `json:"label"`
+	}, callback string) {
+		t.Helper()
+
+		res := get(ts.URL + "/auth/oidc/login?label=laptop")
+		if res.StatusCode != http.StatusFound {
+			t.Fatalf("login should redirect to the provider, got %v", res.StatusCode)
+		}
+		res = get(res.Header.Get("Location"))
+		if res.StatusCode != http.StatusFound {
+			t.Fatalf("provider should redirect back, got %v", res.StatusCode)
+		}
+		callback = res.Header.Get("Location")
+
+		res = get(callback)
+		body, _ := io.ReadAll(res.Body)
+		if res.StatusCode != http.StatusCreated {
+			t.Fatalf("callback failed: %v %v", res.StatusCode, string(body))
+		}
+		if err := json.Unmarshal(body, &tok); err != nil {
+			t.Fatal(err)
+		}
+		return
+	}
+
+	// userOf returns the user the token belongs to
+	userOf := func(tok string) *database.User {
+		t.Helper()
+
+		tm, err := database.NewTokenRepository(db).Find(tok)
+		if err != nil {
+			t.Fatal(err)
+		}
+		u, err := database.NewUserRepository(db).Find(tm.UserId)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return u
+	}
+
+	first, callback := login()
+	if first.Label != "laptop" {
+		t.Errorf("token should have the label from the login: %+v", first)
+	}
+	if u := userOf(first.Token); u.Name != "alice" {
+		t.Errorf("new user should be named after the username, got %v", u.Name)
+	}
+
+	req, _ := http.NewRequest("GET", ts.URL+"/ping", nil)
+	req.Header.Set("Authorization", "Bearer "+first.Token)
+	res, err := client.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	res.Body.Close()
+	if res.StatusCode != http.StatusOK {
+		t.Errorf("issued token doesn't work: %v", res.StatusCode)
+	}
+
+	if res := get(callback); res.StatusCode != http.StatusBadRequest {
+		t.Errorf("callback should not be replayed: want 400, got %v", res.StatusCode)
+	}
+
+	// A login started in one browser can't be finished in another one
+	res = get(ts.URL + "/auth/oidc/login")
+	res = get(res.Header.Get("Location"))
+	victim, err := newBrowser().Get(res.Header.Get("Location"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	victim.Body.Close()
+	if victim.StatusCode != http.StatusBadRequest {
+		t.Errorf("login should be bound to the browser that started it: want 400, got %v", victim.StatusCode)
+	}
+
+	second, _ := login()
+	if a, b := userOf(first.Token), userOf(second.Token); a.ID != b.ID {
+		t.Errorf("the same subject should log in as the same user, got %v and %v", a.Name, b.Name)
+	}
+
+	// Another subject can't take over an existing user by having its name at the provider
+	fake.Subject = "5678"
+	fake.PreferredUsername = "default"
+	other, _ := login()
+	if u := userOf(other.Token); u.ID == database.DefaultUserId || u.Name == "default" {
+		t.Errorf("existing user was taken over: %+v", u)
+	}
+}
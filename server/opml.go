@@ -0,0 +1,176 @@
+// OPML import and export of subscriptions
+
+package server
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/3elDU/rss-reader-backend/opml"
+)
+
+// Maximum size of an uploaded OPML document
+const maxOPMLSize = 10 << 20
+
+const (
+	ImportCreated = "created"
+	ImportSkipped = "skipped"
+	ImportFailed  = "failed"
+)
+
+// ImportResult describes what happened to a single feed from the imported OPML document.
+type ImportResult struct {
+	Url   string `json:"url"`
+	Title string `json:"title,omitempty"`
+	// Folder that the feed was nested in. Empty for the top-level feeds.
+	Folder string `json:"folder,omitempty"`
+	// One of ImportCreated, ImportSkipped or ImportFailed
+	Status string `json:"status"`
+	// Id of the created subscription, or of the existing one when the feed was skipped
+	SubscriptionId int64  `json:"subscriptionId,omitempty"`
+	Error          string `json:"error,omitempty"`
+}
+
+// ImportOPML subscribes the user to every feed in the OPML document.
+// Feeds that the user is already subscribed to are skipped, and failing feeds don't stop the import.
+// An error is returned only if the document itself can't be parsed.
+func (s *Server) ImportOPML(userId int64, r io.Reader) ([]ImportResult, error) {
+	doc, err := opml.Parse(r)
+	if err != nil {
+		return nil, err
+	}
+
+	feeds := doc.Feeds()
+	out := make([]ImportResult, len(feeds))
+	for i, o := range feeds {
+		res := &out[i]
+		res.Url = o.XMLURL
+		res.Title = o.Name()
+		res.Folder = o.Folder
+
+		if err := s.v.Var(o.XMLURL, "http_url"); err != nil {
+			res.Status = ImportFailed
+			res.Error = "invalid feed url"
+			continue
+		}
+
+		ex, id, err := s.sr.SubscriptionExists(o.XMLURL)
+		if err == nil && ex {
+			ex, err = s.sr.IsSubscribed(userId, id)
+		}
+		if err != nil {
+			res.Status = ImportFailed
+			res.Error = err.Error()
+			continue
+		} else if ex {
+			res.Status = ImportSkipped
+			res.SubscriptionId = id
+			continue
+		}
+
+		// Nested outlines are mapped onto folders with the same title
+		var folderId int64
+		if o.Folder != "" {
+			folderId, err = s.findOrCreateFolder(userId, o.Folder)
+			if err != nil {
+				res.Status = ImportFailed
+				res.Error = err.Error()
+				continue
+			}
+		}
+
+		sr, err := s.createSubscription(userId, o.XMLURL, o.Name(), o.Description, folderId)
+		if err != nil {
+			log.Printf("opml import: failed to subscribe to %v: %v", o.XMLURL, err)
+			res.Status = ImportFailed
+			res.Error = err.Error()
+			continue
+		}
+
+		res.Status = ImportCreated
+		res.SubscriptionId = sr.Id
+		res.Title = sr.Title
+	}
+
+	return out, nil
+}
+
+func (s *Server) importOPML(w http.ResponseWriter, r *http.Request) error {
+	res, err := s.ImportOPML(userId(r), http.MaxBytesReader(w, r.Body, maxOPMLSize))
+	if err != nil {
+		log.Printf("invalid opml: %v", err)
+		jsonError(w, http.StatusBadRequest, "invalid opml document")
+		return nil
+	}
+
+	enc, _ := json.Marshal(res)
+	w.Write(enc)
+	return nil
+}
+
+// ExportOPML writes all subscriptions of the user to w as an OPML 2.0 document.
+func (s *Server) ExportOPML(userId int64, w io.Writer) error {
+	sms, err := s.sr.ForUser(userId)
+	if err != nil {
+		return err
+	}
+
+	fms, err := s.fr.All(userId)
+	if err != nil {
+		return err
+	}
+
+	doc := opml.Document{
+		Head: opml.Head{
+			Title:       "RSS reader subscriptions",
+			DateCreated: time.Now().UTC().Format(time.RFC1123Z),
+		},
+	}
+
+	// Subscriptions in a folder are nested in the outline for that folder,
+	// and the rest of them go directly into the body after the folders
+	folders := make([]opml.Outline, len(fms))
+	index := make(map[int64]int, len(fms))
+	for i, fm := range fms {
+		folders[i] = opml.Outline{Text: fm.Title, Title: fm.Title}
+		index[fm.ID] = i
+	}
+
+	unfiled := []opml.Outline{}
+	for _, sm := range sms {
+		o := opml.Outline{
+			Text:        sm.Title,
+			Title:       sm.Title,
+			Type:        sm.Type,
+			XMLURL:      sm.Url,
+			HTMLURL:     sm.Link.String,
+			Description: sm.Description.String,
+		}
+
+		if i, ok := index[sm.FolderId.Int64]; ok && sm.FolderId.Valid {
+			folders[i].Outlines = append(folders[i].Outlines, o)
+		} else {
+			unfiled = append(unfiled, o)
+		}
+	}
+	doc.Body.Outlines = append(folders, unfiled...)
+
+	return doc.Write(w)
+}
+
+func (s *Server) exportOPML(w http.ResponseWriter, r *http.Request) error {
+	// Render into a buffer first, so that the error can still be reported properly
+	buf := &bytes.Buffer{}
+	if err := s.ExportOPML(userId(r), buf); err != nil {
+		return err
+	}
+
+	w.Header().Set("Content-Type", "application/xml; charset=utf-8")
+	w.Header().Set("Content-Disposition", `attachment; filename="subscriptions.opml"`)
+	w.Write(buf.Bytes())
+	return nil
+}
@@ -0,0 +1,167 @@
+package server_test
+
+import (
+	"io"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/3elDU/rss-reader-backend/opml"
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestImportOPML(t *testing.T) {
+	ts, _ := newIsolatedServer(t, map[string]mockResponse{
+		"https://example.com/rss.xml": {200, `<?xml version="1.0" encoding="UTF-8"?>
+			<rss version="2.0">
+				<channel>
+					<title>Test Feed</title>
+					<link>https://example.com</link>
+				</channel>
+			</rss>`,
+		},
+		"https://example.com/nested.xml": {200, `<?xml version="1.0" encoding="UTF-8"?>
+			<rss version="2.0">
+				<channel>
+					<title>Nested Feed</title>
+					<link>https://example.com/nested</link>
+				</channel>
+			</rss>`,
+		},
+		"https://example.com/404.xml": {404, "404 not found"},
+	})
+
+	doc := `<?xml version="1.0" encoding="UTF-8"?>
+		<opml version="2.0">
+			<head><title>Subscriptions</title></head>
+			<body>
+				<outline text="My feed" type="rss" xmlUrl="https://example.com/rss.xml"/>
+				<outline text="Same feed again" type="rss" xmlUrl="https://example.com/rss.xml"/>
+				<outline text="Broken" type="rss" xmlUrl="https://example.com/404.xml"/>
+				<outline text="Not a url" type="rss" xmlUrl="example"/>
+				<outline text="Folder">
+					<outline text="Nested Feed" type="rss" xmlUrl="https://example.com/nested.xml"/>
+				</outline>
+			</body>
+		</opml>`
+
+	res, err := http.Post(ts.URL+"/import/opml", "text/x-opml", strings.NewReader(doc))
+	if err != nil {
+		t.Fatalf("request failed: %v", err)
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode != http.StatusOK {
+		t.Errorf("expected status 200, got %v", res.StatusCode)
+	}
+
+	body, err := io.ReadAll(res.Body)
+	if err != nil {
+		t.Fatalf("failed to read response body: %v", err)
+	}
+
+	want := `[` +
+		`{"url":"https://example.com/rss.xml","title":"My feed","status":"created","subscriptionId":1},` +
+		`{"url":"https://example.com/rss.xml","title":"Same feed again","status":"skipped","subscriptionId":1},` +
+		`{"url":"https://example.com/404.xml","title":"Broken","status":"failed","error":"http error: "},` +
+		`{"url":"example","title":"Not a url","status":"failed","error":"invalid feed url"},` +
+		`{"url":"https://example.com/nested.xml","title":"Nested Feed","folder":"Folder","status":"created","subscriptionId":2}` +
+		`]`
+	if diff := cmp.Diff(want, string(body)); diff != "" {
+		t.Errorf("unexpected response body (-want +got):\n%v", diff)
+	}
+
+	// Nested outline has been mapped onto a folder
+	if status, body := doRequest(t, "GET", ts.URL+"/folders", ""); body != `[{"id":1,"title":"Folder"}]` {
+		t.Errorf("unexpected folders: %v %v", status, body)
+	}
+	if status, body := doRequest(t, "GET", ts.URL+"/subscriptions/2", ""); !strings.HasSuffix(body, `"folderId":1}`) {
+		t.Errorf("expected nested feed to be in the folder, got %v %v", status, body)
+	}
+
+	res, err = http.Post(ts.URL+"/import/opml", "text/x-opml", strings.NewReader("<rss/>"))
+	if err != nil {
+		t.Fatalf("request failed: %v", err)
+	}
+	res.Body.Close()
+
+	if res.StatusCode != http.StatusBadRequest {
+		t.Errorf("expected status 400 for an invalid document, got %v", res.StatusCode)
+	}
+}
+
+func TestExportOPML(t *testing.T) {
+	ts, _ := newIsolatedServer(t, map[string]mockResponse{
+		"https://example.com/rss.xml": {200, `<?xml version="1.0" encoding="UTF-8"?>
+			<rss version="2.0">
+				<channel>
+					<title>Test Feed</title>
+					<link>https://example.com</link>
+					<description>Test feed for testing</description>
+				</channel>
+			</rss>`,
+		},
+		"https://example.com/other.xml": {200, `<?xml version="1.0" encoding="UTF-8"?>
+			<rss version="2.0">
+				<channel>
+					<title>Other Feed</title>
+				</channel>
+			</rss>`,
+		},
+	})
+
+	if status, body := doRequest(t, "POST", ts.URL+"/folders", `{"title": "News"}`); status != http.StatusCreated {
+		t.Fatalf("failed to create a folder: %v %v", status, body)
+	}
+	if status, body := doRequest(t, "POST", ts.URL+"/folders", `{"title": "Empty"}`); status != http.StatusCreated {
+		t.Fatalf("failed to create a folder: %v %v", status, body)
+	}
+	if status, body := doRequest(t, "POST", ts.URL+"/subscribe",
+		`{"url": "https://example.com/rss.xml", "title": "Custom <title>", "folderId": 1}`,
+	); status != http.StatusCreated {
+		t.Fatalf("failed to subscribe: %v %v", status, body)
+	}
+	if status, body := doRequest(t, "POST", ts.URL+"/subscribe", `{"url": "https://example.com/other.xml"}`); status != http.StatusCreated {
+		t.Fatalf("failed to subscribe: %v %v", status, body)
+	}
+
+	res, err := http.Get(ts.URL + "/export/opml")
+	if err != nil {
+		t.Fatalf("request failed: %v", err)
+	}
+	defer res.Body.Close()
+
+	if ct := res.Header.Get("Content-Type"); ct != "application/xml; charset=utf-8" {
+		t.Errorf("unexpected content type '%v'", ct)
+	}
+
+	doc, err := opml.Parse(res.Body)
+	if err != nil {
+		t.Fatalf("exported document is not valid opml: %v", err)
+	}
+
+	want := []opml.Feed{
+		{
+			Outline: opml.Outline{
+				Text:        "Custom <title>",
+				Title:       "Custom <title>",
+				Type:        "rss",
+				XMLURL:      "https://example.com/rss.xml",
+				HTMLURL:     "https://example.com",
+				Description: "Test feed for testing",
+			},
+			Folder: "News",
+		},
+		{
+			Outline: opml.Outline{
+				Text:   "Other Feed",
+				Title:  "Other Feed",
+				Type:   "rss",
+				XMLURL: "https://example.com/other.xml",
+			},
+		},
+	}
+	if diff := cmp.Diff(want, doc.Feeds()); diff != "" {
+		t.Errorf("exported feeds mismatch (-want +got):\n%v", diff)
+	}
+}
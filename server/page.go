@@ -0,0 +1,40 @@
+package server
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/3elDU/rss-reader-backend/database"
+)
+
+const (
+	defaultPageLimit = 50
+	maxPageLimit     = 200
+)
+
+var errInvalidLimit = errors.New("invalid limit")
+
+// parsePage reads the "limit" and "after" query parameters of a paginated listing.
+func parsePage(r *http.Request) (database.Page, error) {
+	q := r.URL.Query()
+	p := database.Page{Limit: defaultPageLimit}
+
+	if v := q.Get("limit"); v != "" {
+		limit, err := strconv.Atoi(v)
+		if err != nil || limit < 1 {
+			return p, errInvalidLimit
+		}
+		p.Limit = min(limit, maxPageLimit)
+	}
+
+	if v := q.Get("after"); v != "" {
+		c, err := database.DecodeCursor(v)
+		if err != nil {
+			return p, err
+		}
+		p.After = c
+	}
+
+	return p, nil
+}
@@ -0,0 +1,105 @@
+package server_test
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/url"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestPagination(t *testing.T) {
+	ts, db := newIsolatedServer(t, map[string]mockResponse{
+		"https://example.com/rss.xml": {200, `<?xml version="1.0" encoding="UTF-8"?>
+			<rss version="2.0">
+				<channel>
+					<title>Test Feed</title>
+					<item><title>1</title><link>https://example.com/1</link><pubDate>Mon, 01 Jan 2024 00:00:00 +0000</pubDate></item>
+					<item><title>2</title><link>https://example.com/2</link><pubDate>Tue, 02 Jan 2024 00:00:00 +0000</pubDate></item>
+					<item><title>3</title><link>https://example.com/3</link><pubDate>Tue, 02 Jan 2024 00:00:00 +0000</pubDate></item>
+					<item><title>4</title><link>https://example.com/4</link><pubDate>Tue, 02 Jan 2024 00:00:00 +0000</pubDate></item>
+					<item><title>5</title><link>https://example.com/5</link><pubDate>Wed, 03 Jan 2024 00:00:00 +0000</pubDate></item>
+				</channel>
+			</rss>`,
+		},
+	})
+
+	if status, body := doRequest(t, "POST", ts.URL+"/subscribe", `{"url": "https://example.com/rss.xml"}`); status != http.StatusCreated {
+		t.Fatalf("failed to subscribe: %v %v", status, body)
+	}
+
+	type page struct {
+		Items []struct {
+			Id int64 `json:"id"`
+		} `json:"items"`
+		Next string `json:"next"`
+	}
+
+	tests := []struct {
+		path string
+		want []int64
+	}{
+		// Newest first, articles with the same date are ordered by id
+		{"/unread", []int64{5, 4, 3, 2, 1}},
+		// The article inserted during the previous listing is already there
+		{"/subscriptions/1/articles", []int64{6, 5, 4, 3, 2, 1}},
+	}
+
+	for _, test := range tests {
+		path := test.path
+		t.Run(path, func(t *testing.T) {
+			got := []int64{}
+			after := ""
+
+			for i := 0; ; i++ {
+				query := url.Values{"limit": {"2"}}
+				if after != "" {
+					query.Set("after", after)
+				}
+
+				status, body := doRequest(t, "GET", ts.URL+path+"?"+query.Encode(), "")
+				if status != http.StatusOK {
+					t.Fatalf("bad http status code: want 200, got %v %v", status, body)
+				}
+
+				p := page{}
+				if err := json.Unmarshal([]byte(body), &p); err != nil {
+					t.Fatalf("failed to decode response: %v", err)
+				}
+				if len(p.Items) > 2 {
+					t.Errorf("page has %v items, more than the limit", len(p.Items))
+				}
+				for _, item := range p.Items {
+					got = append(got, item.Id)
+				}
+
+				// A new article appearing in the middle of the listing must not shift the pages
+				if i == 0 {
+					_, err := db.Exec(`INSERT INTO articles (subscription_id, url, title, created, guid)
+						VALUES (1, ?1, 'new', '2030-01-01 00:00:00', ?1)`,
+						"https://example.com/new"+path,
+					)
+					if err != nil {
+						t.Fatal(err)
+					}
+				}
+
+				if p.Next == "" {
+					break
+				}
+				after = p.Next
+			}
+
+			if diff := cmp.Diff(test.want, got); diff != "" {
+				t.Errorf("unexpected articles (-want +got):\n%v", diff)
+			}
+		})
+	}
+
+	for _, query := range []string{"limit=0", "limit=abc", "after=abc", "after=e30"} {
+		if status, _ := doRequest(t, "GET", ts.URL+"/unread?"+query, ""); status != http.StatusBadRequest {
+			t.Errorf("expected status 400 for '%v', got %v", query, status)
+		}
+	}
+}
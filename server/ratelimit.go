@@ -0,0 +1,75 @@
+package server
+
+import (
+	"net"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// rateLimiter counts events per key, like failed logins per client, in fixed windows
+type rateLimiter struct {
+	limit  int
+	window time.Duration
+
+	mu     sync.Mutex
+	counts map[string]*rateWindow
+}
+
+type rateWindow struct {
+	count int
+	ends  time.Time
+}
+
+func newRateLimiter(limit int, window time.Duration) *rateLimiter {
+	return &rateLimiter{
+		limit:  limit,
+		window: window,
+		counts: map[string]*rateWindow{},
+	}
+}
+
+// exceeded reports whether the key reached the limit in the current window, and when the window ends
+func (l *rateLimiter) exceeded(key string) (bool, time.Time) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	w, ok := l.counts[key]
+	if !ok || time.Now().After(w.ends) {
+		return false, time.Time{}
+	}
+
+	return w.count >= l.limit, w.ends
+}
+
+// add counts an event for the key
+func (l *rateLimiter) add(key string) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	now := time.Now()
+	w, ok := l.counts[key]
+	if !ok || now.After(w.ends) {
+		// Windows that ended are dropped, so that the map doesn't grow with every client ever seen
+		for k, w := range l.counts {
+			if now.After(w.ends) {
+				delete(l.counts, k)
+			}
+		}
+
+		w = &rateWindow{ends: now.Add(l.window)}
+		l.counts[key] = w
+	}
+
+	w.count++
+}
+
+// clientIP returns the address the request came from. Clients behind the same proxy share it.
+func clientIP(r *http.Request) string {
+	ip, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+
+	return ip
+}
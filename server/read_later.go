@@ -15,12 +15,12 @@ func (s *Server) addToReadLater(w http.ResponseWriter, r *http.Request) error {
 		return nil
 	}
 
-	a, err := s.ar.Find(int64(id))
+	a, err := s.ar.FindForUser(userId(r), int64(id))
 	if err != nil {
 		return err
 	}
 
-	if err := s.ar.AddToReadLater(a); err != nil {
+	if err := s.ar.AddToReadLater(userId(r), &a.Article); err != nil {
 		return err
 	}
 
@@ -35,12 +35,12 @@ func (s *Server) removeFromReadLater(w http.ResponseWriter, r *http.Request) err
 		return nil
 	}
 
-	a, err := s.ar.Find(int64(id))
+	a, err := s.ar.FindForUser(userId(r), int64(id))
 	if err != nil {
 		return err
 	}
 
-	if err := s.ar.RemoveFromReadLater(a); err == nil {
+	if err := s.ar.RemoveFromReadLater(userId(r), &a.Article); err == nil {
 		w.WriteHeader(http.StatusNoContent)
 	}
 
@@ -48,17 +48,18 @@ func (s *Server) removeFromReadLater(w http.ResponseWriter, r *http.Request) err
 }
 
 func (s *Server) showReadLater(w http.ResponseWriter, r *http.Request) error {
-	arl, err := s.ar.InReadLater()
+	page, err := parsePage(r)
 	if err != nil {
-		return err
+		w.WriteHeader(http.StatusBadRequest)
+		return nil
 	}
 
-	ars := make([]resource.ArticleWithSubscription, len(arl))
-	for i, arl := range arl {
-		ars[i] = resource.NewArticleWithSubscription(arl)
+	arl, next, err := s.ar.InReadLater(userId(r), page)
+	if err != nil {
+		return err
 	}
 
-	enc, _ := json.Marshal(ars)
+	enc, _ := json.Marshal(resource.NewArticlePage(arl, next))
 	w.Write(enc)
 	return nil
 }
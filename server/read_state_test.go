@@ -0,0 +1,125 @@
+package server_test
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestReadState(t *testing.T) {
+	ts, _ := newIsolatedServer(t, map[string]mockResponse{
+		"https://example.com/rss.xml": {200, `<?xml version="1.0" encoding="UTF-8"?>
+			<rss version="2.0">
+				<channel>
+					<title>Test Feed</title>
+					<item>
+						<title>First</title>
+						<link>https://example.com/first</link>
+						<pubDate>Tue, 24 Dec 2024 03:00:00 GMT</pubDate>
+					</item>
+					<item>
+						<title>Second</title>
+						<link>https://example.com/second</link>
+						<pubDate>Tue, 24 Dec 2024 02:00:00 GMT</pubDate>
+					</item>
+					<item>
+						<title>Third</title>
+						<link>https://example.com/third</link>
+						<pubDate>Tue, 24 Dec 2024 01:00:00 GMT</pubDate>
+					</item>
+				</channel>
+			</rss>`,
+		},
+	})
+
+	if status, body := doRequest(t, "POST", ts.URL+"/subscribe", `{"url": "https://example.com/rss.xml"}`); status != http.StatusCreated {
+		t.Fatalf("failed to subscribe: %v %v", status, body)
+	}
+
+	type state struct {
+		Id     int64  `json:"id"`
+		New    bool   `json:"new"`
+		Seen   bool   `json:"seen"`
+		ReadAt string `json:"readAt"`
+	}
+	list := func(path string) []state {
+		t.Helper()
+
+		status, body := doRequest(t, "GET", ts.URL+path, "")
+		if status != http.StatusOK {
+			t.Fatalf("bad http status code: want 200, got %v %v", status, body)
+		}
+
+		p := struct {
+			Items []state `json:"items"`
+		}{}
+		if err := json.Unmarshal([]byte(body), &p); err != nil {
+			t.Fatalf("failed to decode response: %v", err)
+		}
+		return p.Items
+	}
+
+	steps := []struct {
+		request string
+		unread  []state
+		unseen  []state
+	}{
+		{
+			"POST /articles/1/markseen",
+			[]state{{1, true, true, ""}, {2, true, false, ""}, {3, true, false, ""}},
+			[]state{{2, true, false, ""}, {3, true, false, ""}},
+		},
+		{
+			"POST /articles/2/markread",
+			[]state{{1, true, true, ""}, {3, true, false, ""}},
+			[]state{{3, true, false, ""}},
+		},
+		{
+			// Article stays seen, even though it's unread again
+			"POST /articles/2/markunread",
+			[]state{{1, true, true, ""}, {2, true, true, ""}, {3, true, false, ""}},
+			[]state{{3, true, false, ""}},
+		},
+	}
+
+	for _, step := range steps {
+		method, path, _ := strings.Cut(step.request, " ")
+		if status, body := doRequest(t, method, ts.URL+path, ""); status != http.StatusOK {
+			t.Fatalf("%v: bad http status code: want 200, got %v %v", step.request, status, body)
+		}
+
+		if diff := cmp.Diff(step.unread, list("/unread")); diff != "" {
+			t.Errorf("%v: unexpected unread articles (-want +got):\n%v", step.request, diff)
+		}
+		if diff := cmp.Diff(step.unseen, list("/unread?unseen=true")); diff != "" {
+			t.Errorf("%v: unexpected unseen articles (-want +got):\n%v", step.request, diff)
+		}
+	}
+
+	// Read articles have the time when they were read
+	doRequest(t, "POST", ts.URL+"/articles/3/markread", "")
+	status, body := doRequest(t, "GET", ts.URL+"/articles/3", "")
+	read := state{}
+	if err := json.Unmarshal([]byte(body), &read); status != http.StatusOK || err != nil {
+		t.Fatalf("failed to get the article: %v %v", status, body)
+	}
+	if read.New || !read.Seen || read.ReadAt == "" {
+		t.Errorf("unexpected state of the read article: %+v", read)
+	}
+
+	for path, want := range map[string]int{
+		"/articles/42/markunread": http.StatusNotFound,
+		"/articles/42/markseen":   http.StatusNotFound,
+		"/articles/x/markunread":  http.StatusBadRequest,
+	} {
+		if status, body := doRequest(t, "POST", ts.URL+path, ""); status != want {
+			t.Errorf("%v: bad http status code: want %v, got %v %v", path, want, status, body)
+		}
+	}
+	if status, body := doRequest(t, "GET", ts.URL+"/unread?unseen=maybe", ""); status != http.StatusBadRequest {
+		t.Errorf("bad http status code: want 400, got %v %v", status, body)
+	}
+}
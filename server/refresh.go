@@ -6,15 +6,17 @@ import (
 	"net/http"
 )
 
+// refresh refreshes the feeds the user is subscribed to which are due, and responds with the results for each of them.
+// Feeds that aren't due yet, because they were fetched recently or are backed off, are skipped and not in the results.
+// Feeds that failed to refresh don't make the request fail, their errors are reported in the results.
 func (s *Server) refresh(w http.ResponseWriter, r *http.Request) error {
-	new, err := s.r.Refresh()
+	res, err := s.r.RefreshDueForUser(userId(r))
 	if err != nil {
 		log.Printf("error whilst refreshing articles: %v", err)
-		w.WriteHeader(http.StatusInternalServerError)
 		return err
 	}
 
-	data, _ := json.Marshal(new)
+	data, _ := json.Marshal(res)
 	w.Write(data)
 	return nil
 }
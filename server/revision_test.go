@@ -0,0 +1,116 @@
+package server_test
+
+import (
+	"encoding/json"
+	"net/http"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestArticleRevisions(t *testing.T) {
+	ts, db := newIsolatedServer(t, map[string]mockResponse{
+		"https://example.com/rss.xml": {200, `<?xml version="1.0" encoding="UTF-8"?>
+			<rss version="2.0">
+				<channel>
+					<title>Test Feed</title>
+					<item>
+						<title>Minister resigns</title>
+						<link>https://example.com/news</link>
+						<description>The minister resigned on Monday.</description>
+					</item>
+				</channel>
+			</rss>`,
+		},
+	})
+
+	if status, body := doRequest(t, "POST", ts.URL+"/subscribe", `{"url": "https://example.com/rss.xml"}`); status != http.StatusCreated {
+		t.Fatalf("failed to subscribe: %v %v", status, body)
+	}
+
+	// Silent corrections by the publisher
+	for _, q := range []string{
+		"UPDATE articles SET description = 'The minister resigned on Tuesday.', updated_at = '2025-01-01 00:00:00' WHERE id = 1",
+		"UPDATE articles SET title = 'Minister resigns after scandal', updated_at = '2025-01-02 00:00:00' WHERE id = 1",
+		// Not a new revision, since neither the title nor the description changed
+		"UPDATE articles SET url = 'https://example.com/minister' WHERE id = 1",
+	} {
+		if _, err := db.Exec(q); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	type revision struct {
+		Revision    int    `json:"revision"`
+		Title       string `json:"title"`
+		Description string `json:"description"`
+	}
+	type history struct {
+		ArticleId int64      `json:"articleId"`
+		Revisions []revision `json:"revisions"`
+		From      int        `json:"from"`
+		To        int        `json:"to"`
+		Diff      string     `json:"diff"`
+	}
+
+	wantRevisions := []revision{
+		{1, "Minister resigns", "The minister resigned on Monday."},
+		{2, "Minister resigns", "The minister resigned on Tuesday."},
+		{3, "Minister resigns after scandal", "The minister resigned on Tuesday."},
+	}
+
+	tests := []struct {
+		name  string
+		query string
+		want  history
+	}{
+		{
+			"previous and current",
+			"",
+			history{1, wantRevisions, 2, 3,
+				"--- revision 2\n+++ revision 3\n@@ -1,3 +1,3 @@\n" +
+					"-Minister resigns\n+Minister resigns after scandal\n \n The minister resigned on Tuesday.\n",
+			},
+		},
+		{
+			"first and current",
+			"?from=1&to=3",
+			history{1, wantRevisions, 1, 3,
+				"--- revision 1\n+++ revision 3\n@@ -1,3 +1,3 @@\n" +
+					"-Minister resigns\n+Minister resigns after scandal\n \n" +
+					"-The minister resigned on Monday.\n+The minister resigned on Tuesday.\n",
+			},
+		},
+		{
+			"same revision",
+			"?from=2&to=2",
+			history{1, wantRevisions, 2, 2, ""},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			status, body := doRequest(t, "GET", ts.URL+"/articles/1/revisions"+test.query, "")
+			if status != http.StatusOK {
+				t.Fatalf("bad http status code: want 200, got %v %v", status, body)
+			}
+
+			got := history{}
+			if err := json.Unmarshal([]byte(body), &got); err != nil {
+				t.Fatalf("failed to decode response: %v", err)
+			}
+			if diff := cmp.Diff(test.want, got); diff != "" {
+				t.Errorf("unexpected history (-want +got):\n%v", diff)
+			}
+		})
+	}
+
+	for _, path := range []string{"/articles/1/revisions?from=0&to=3", "/articles/1/revisions?from=1", "/articles/x/revisions"} {
+		if status, body := doRequest(t, "GET", ts.URL+path, ""); status != http.StatusBadRequest {
+			t.Errorf("%v: bad http status code: want 400, got %v %v", path, status, body)
+		}
+	}
+	if status, body := doRequest(t, "GET", ts.URL+"/articles/42/revisions", ""); status != http.StatusNotFound {
+		t.Errorf("bad http status code: want 404, got %v %v", status, body)
+	}
+}
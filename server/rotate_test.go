@@ -0,0 +1,123 @@
+package server_test
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/3elDU/rss-reader-backend/database"
+	"github.com/3elDU/rss-reader-backend/token"
+)
+
+func TestRotateToken(t *testing.T) {
+	ts, db := newIsolatedServer(t, nil)
+	repo := database.NewTokenRepository(db)
+
+	week := 7 * 24 * time.Hour
+	old := token.New(&week)
+	old.UserId = database.DefaultUserId
+	old.Label = "phone"
+	om := old.ToModel()
+	if err := repo.Insert(&om); err != nil {
+		t.Fatal(err)
+	}
+
+	defer EnableAuthForThisTest()()
+
+	// request sends a request with the given token
+	request := func(tok, method, path string) (int, string) {
+		t.Helper()
+
+		req, err := http.NewRequest(method, ts.URL+path, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		req.Header.Set("Authorization", "Bearer "+tok)
+
+		res, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer res.Body.Close()
+
+		b, _ := io.ReadAll(res.Body)
+		return res.StatusCode, string(b)
+	}
+
+	status, body := request(old.Token, "POST", "/auth/rotate")
+	if status != http.StatusCreated {
+		t.Fatalf("failed to rotate the token: %v %v", status, body)
+	}
+	rotated := struct {
+		Token      string `json:"token"`
+		Label      string `json:"label"`
+		ValidUntil string `json:"validUntil"`
+	}{}
+	if err := json.Unmarshal([]byte(body), &rotated); err != nil {
+		t.Fatal(err)
+	}
+	if rotated.Label != "phone" || rotated.ValidUntil != old.ValidUntil.Format(time.DateTime) {
+		t.Errorf("new token should inherit the old one: %v", body)
+	}
+
+	if status, body := request(old.Token, "GET", "/ping"); status != http.StatusOK {
+		t.Errorf("old token should work during the grace period: %v %v", status, body)
+	}
+	if status, body := request(old.Token, "POST", "/auth/rotate"); status != http.StatusConflict {
+		t.Errorf("old token should not be rotated twice: want 409, got %v %v", status, body)
+	}
+	if status, body := request(rotated.Token, "GET", "/ping"); status != http.StatusOK {
+		t.Errorf("new token doesn't work: %v %v", status, body)
+	}
+
+	tm, err := repo.Find(old.Token)
+	if err != nil {
+		t.Fatal(err)
+	}
+	graceUntil, _ := time.Parse(time.DateTime, tm.ValidUntil.String)
+	if !tm.RotatedAt.Valid || time.Until(graceUntil) > time.Minute {
+		t.Errorf("old token should expire after the grace period: %+v", tm)
+	}
+
+	if status, body := request(rotated.Token, "GET", "/tokens"); !strings.Contains(body, `"rotated":true`) {
+		t.Errorf("token list should show the rotated token: %v %v", status, body)
+	}
+}
+
+func TestExpiredToken(t *testing.T) {
+	ts, db := newIsolatedServer(t, nil)
+	repo := database.NewTokenRepository(db)
+
+	tok := token.New(nil)
+	tok.UserId = database.DefaultUserId
+	tok.ValidUntil = time.Now().UTC().Add(-time.Hour).Truncate(time.Second)
+	tm := tok.ToModel()
+	if err := repo.Insert(&tm); err != nil {
+		t.Fatal(err)
+	}
+
+	defer EnableAuthForThisTest()()
+
+	req, err := http.NewRequest("GET", ts.URL+"/ping", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	req.Header.Set("Authorization", "Bearer "+tok.Token)
+	res, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer res.Body.Close()
+
+	body, _ := io.ReadAll(res.Body)
+	if res.StatusCode != http.StatusUnauthorized || !strings.Contains(string(body), "token expired") || res.Header.Get("WWW-Authenticate") == "" {
+		t.Errorf("client should be told that the token expired: %v %v %v", res.StatusCode, res.Header, string(body))
+	}
+
+	if _, err := repo.Find(tok.Token); err == nil {
+		t.Error("expired token should be deleted")
+	}
+}
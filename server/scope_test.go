@@ -0,0 +1,71 @@
+package server_test
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+	"testing"
+)
+
+func TestTokenScopes(t *testing.T) {
+	ts, _ := newIsolatedServer(t, nil)
+
+	// create makes a token while authentication is disabled, and returns it
+	create := func(body string) string {
+		t.Helper()
+
+		status, res := doRequest(t, "POST", ts.URL+"/tokens", body)
+		if status != http.StatusCreated {
+			t.Fatalf("failed to create token: %v %v", status, res)
+		}
+
+		tok := struct {
+			Token  string   `json:"token"`
+			Scopes []string `json:"scopes"`
+		}{}
+		if err := json.Unmarshal([]byte(res), &tok); err != nil {
+			t.Fatal(err)
+		}
+		return tok.Token
+	}
+
+	readOnly := create(`{"label": "dashboard", "scopes": ["read"]}`)
+	tokenManager := create(`{"scopes": ["read", "admin"]}`)
+
+	if status, body := doRequest(t, "POST", ts.URL+"/tokens", `{"scopes": ["superuser"]}`); status != http.StatusBadRequest {
+		t.Errorf("unknown scope: bad http status code: want 400, got %v %v", status, body)
+	}
+
+	defer EnableAuthForThisTest()()
+
+	tests := []struct {
+		token        string
+		method, path string
+		body         string
+		status       int
+		response     string
+	}{
+		{readOnly, "GET", "/ping", ``, 200, `pong`},
+		{readOnly, "GET", "/subscriptions", ``, 200, `[]`},
+		{readOnly, "GET", "/unread", ``, 200, `{"items":[]}`},
+		{readOnly, "POST", "/subscribe", `{"url": "https://example.com/rss.xml"}`, 403, `{"error":true,"message":"token is missing the 'write' scope"}`},
+		{readOnly, "POST", "/refresh", ``, 403, `{"error":true,"message":"token is missing the 'write' scope"}`},
+		{readOnly, "GET", "/tokens", ``, 403, `{"error":true,"message":"token is missing the 'admin' scope"}`},
+		{tokenManager, "POST", "/folders", `{"title": "News"}`, 403, `{"error":true,"message":"token is missing the 'write' scope"}`},
+		// A token can't grant the scopes it doesn't have
+		{tokenManager, "POST", "/tokens", `{"scopes": ["write"]}`, 403, `{"error":true,"message":"can't grant the 'write' scope, the token is missing it"}`},
+	}
+
+	for _, test := range tests {
+		status, body := authorizedRequest(t, test.token, test.method, ts.URL+test.path, test.body)
+		if status != test.status || body != test.response {
+			t.Errorf("%v %v: want %v %v, got %v %v", test.method, test.path, test.status, test.response, status, body)
+		}
+	}
+
+	// Tokens created without the scopes get the scopes of the token that created them
+	status, body := authorizedRequest(t, tokenManager, "POST", ts.URL+"/tokens", `{"label": "inherited"}`)
+	if status != http.StatusCreated || !strings.Contains(body, `"scopes":["read","admin"]`) {
+		t.Errorf("unexpected token: %v %v", status, body)
+	}
+}
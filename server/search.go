@@ -0,0 +1,76 @@
+package server
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/3elDU/rss-reader-backend/database"
+	"github.com/3elDU/rss-reader-backend/resource"
+)
+
+const (
+	defaultSearchLimit = 50
+	maxSearchLimit     = 200
+)
+
+// search performs a full-text search over the articles of the user.
+//
+// Query parameters:
+//   - q: the search query, required
+//   - subscription: only search in the subscription with this id
+//   - folder: only search in the subscriptions from the folder with this id
+//   - read: "true" to only search the read articles, "false" for the unread ones
+//   - limit: maximum number of results
+func (s *Server) search(w http.ResponseWriter, r *http.Request) error {
+	q := r.URL.Query()
+	f := database.SearchFilter{Limit: defaultSearchLimit}
+
+	var err error
+	if v := q.Get("subscription"); v != "" {
+		if f.SubscriptionId, err = strconv.ParseInt(v, 10, 64); err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			return nil
+		}
+	}
+	if v := q.Get("folder"); v != "" {
+		if f.FolderId, err = strconv.ParseInt(v, 10, 64); err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			return nil
+		}
+	}
+	if v := q.Get("read"); v != "" {
+		read, err := strconv.ParseBool(v)
+		if err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			return nil
+		}
+		f.Read = sql.NullBool{Valid: true, Bool: read}
+	}
+	if v := q.Get("limit"); v != "" {
+		if f.Limit, err = strconv.Atoi(v); err != nil || f.Limit < 1 {
+			w.WriteHeader(http.StatusBadRequest)
+			return nil
+		}
+		f.Limit = min(f.Limit, maxSearchLimit)
+	}
+
+	res, err := s.ar.Search(userId(r), q.Get("q"), f)
+	if errors.Is(err, database.ErrEmptyQuery) {
+		jsonError(w, http.StatusBadRequest, "search query is empty")
+		return nil
+	} else if err != nil {
+		return err
+	}
+
+	srs := make([]resource.SearchResult, len(res))
+	for i, r := range res {
+		srs[i] = resource.NewSearchResult(r)
+	}
+
+	enc, _ := json.Marshal(srs)
+	w.Write(enc)
+	return nil
+}
@@ -0,0 +1,111 @@
+package server_test
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestSearch(t *testing.T) {
+	ts, _ := newIsolatedServer(t, map[string]mockResponse{
+		"https://example.com/rss.xml": {200, `<?xml version="1.0" encoding="UTF-8"?>
+			<rss version="2.0">
+				<channel>
+					<title>Test Feed</title>
+					<item>
+						<title>Full-text search in SQLite</title>
+						<link>https://example.com/fts</link>
+						<description>How to search articles with the FTS5 extension</description>
+					</item>
+					<item>
+						<title>Databases for beginners</title>
+						<link>https://example.com/databases</link>
+						<description>Text about tables, and a bit about search</description>
+					</item>
+					<item>
+						<title>Cooking pasta</title>
+						<link>https://example.com/pasta</link>
+						<description>Nothing to do with software</description>
+					</item>
+				</channel>
+			</rss>`,
+		},
+		"https://example.com/other.xml": {200, `<?xml version="1.0" encoding="UTF-8"?>
+			<rss version="2.0">
+				<channel>
+					<title>Other Feed</title>
+					<item>
+						<title>Search engines</title>
+						<link>https://example.com/engines</link>
+					</item>
+					<item>
+						<title>Tomatoes</title>
+						<link>https://example.com/tomatoes</link>
+						<description><![CDATA[<p class="markup">Tomato <b>recipes</b> &lt;3</p><script>var recipes</script>]]></description>
+					</item>
+				</channel>
+			</rss>`,
+		},
+	})
+
+	for _, feed := range []string{"https://example.com/rss.xml", "https://example.com/other.xml"} {
+		if status, body := doRequest(t, "POST", ts.URL+"/subscribe", fmt.Sprintf(`{"url": %q}`, feed)); status != http.StatusCreated {
+			t.Fatalf("failed to subscribe: %v %v", status, body)
+		}
+	}
+	if status, body := doRequest(t, "POST", ts.URL+"/articles/1/markread", ""); status != http.StatusOK {
+		t.Fatalf("failed to mark article as read: %v %v", status, body)
+	}
+
+	type result struct {
+		Id      int64  `json:"id"`
+		Snippet string `json:"snippet"`
+	}
+
+	tests := []struct {
+		name  string
+		query string
+		want  []result
+	}{
+		{"word", "q=pasta", []result{{3, "Cooking <mark>pasta</mark>"}}},
+		{
+			"ranking", "q=search",
+			[]result{{4, "<mark>Search</mark> engines"}, {1, "Full-text <mark>search</mark> in SQLite"}, {2, "Text about tables, and a bit about <mark>search</mark>"}},
+		},
+		{"phrase", "q=" + url.QueryEscape(`"search articles"`), []result{{1, "How to <mark>search articles</mark> with the FTS5 extension"}}},
+		{"phrase does not match separate words", "q=" + url.QueryEscape(`"bit search"`), []result{}},
+		{"prefix", "q=databa*", []result{{2, "<mark>Databases</mark> for beginners"}}},
+		{"filter by subscription", "q=search&subscription=2", []result{{4, "<mark>Search</mark> engines"}}},
+		{"only unread", "q=search&read=false&limit=1", []result{{4, "<mark>Search</mark> engines"}}},
+		{"only read", "q=search&read=true", []result{{1, "Full-text <mark>search</mark> in SQLite"}}},
+		{"special characters", "q=" + url.QueryEscape(`full-text AND (`), []result{}},
+		{"text of html is escaped", "q=recipes", []result{{5, "Tomato <mark>recipes</mark> &lt;3"}}},
+		{"markup is not indexed", "q=markup", []result{}},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			status, body := doRequest(t, "GET", ts.URL+"/search?"+test.query, "")
+			if status != http.StatusOK {
+				t.Fatalf("bad http status code: want 200, got %v %v", status, body)
+			}
+
+			got := []result{}
+			if err := json.Unmarshal([]byte(body), &got); err != nil {
+				t.Fatalf("failed to decode response: %v", err)
+			}
+
+			if diff := cmp.Diff(test.want, got); diff != "" {
+				t.Errorf("unexpected results (-want +got):\n%v", diff)
+			}
+		})
+	}
+
+	if status, _ := doRequest(t, "GET", ts.URL+"/search?q=%20", ""); status != http.StatusBadRequest {
+		t.Errorf("expected status 400 for an empty query, got %v", status)
+	}
+}
@@ -1,11 +1,16 @@
 package server
 
 import (
+	"crypto/cipher"
+	"encoding/json"
 	"net/http"
+	"time"
 
 	"github.com/3elDU/rss-reader-backend/database"
 	"github.com/3elDU/rss-reader-backend/middleware"
+	"github.com/3elDU/rss-reader-backend/oidc"
 	"github.com/3elDU/rss-reader-backend/refresh"
+	"github.com/3elDU/rss-reader-backend/token"
 	"github.com/go-playground/validator/v10"
 	"github.com/jmoiron/sqlx"
 	"github.com/mmcdole/gofeed"
@@ -17,56 +22,137 @@ type Server struct {
 	tr database.TokenRepository
 	ar database.ArticleRepository
 	sr database.SubscriptionRepository
+	fr database.FolderRepository
+	ur database.UserRepository
+
+	// Failed logins per client address, see login
+	failedLogins *rateLimiter
 
 	v      *validator.Validate
 	Parser *gofeed.Parser
+	// Maximum and default validity of the tokens issued by the login
+	LoginValidFor time.Duration
+	// Records the uses of the tokens. It's up to the caller to run or flush it, see UsageTracker.Run.
+	Usage *token.UsageTracker
 
 	r *refresh.Task
+
+	// Set by EnableOIDC
+	oidc *oidc.Provider
+	// Encrypts the logins in progress, see oidcLogin
+	loginCipher cipher.AEAD
 }
 
 func NewServer(db *sqlx.DB, refresher *refresh.Task) *Server {
 	s := &Server{
-		ServeMux: http.NewServeMux(),
-		tr:       database.NewTokenRepository(db),
-		ar:       database.NewArticleRepository(db),
-		sr:       database.NewSubscriptionRepository(db),
-		v:        validator.New(),
-		Parser:   gofeed.NewParser(),
-		r:        refresher,
+		ServeMux:      http.NewServeMux(),
+		tr:            database.NewTokenRepository(db),
+		ar:            database.NewArticleRepository(db),
+		sr:            database.NewSubscriptionRepository(db),
+		fr:            database.NewFolderRepository(db),
+		ur:            database.NewUserRepository(db),
+		v:             validator.New(),
+		Parser:        gofeed.NewParser(),
+		LoginValidFor: DefaultLoginValidFor,
+		failedLogins:  newRateLimiter(maxClientFailedLogins, clientFailedLoginsWindow),
+		r:             refresher,
 	}
+	s.Usage = token.NewUsageTracker(s.tr)
 	s.registerRoutes()
 
 	return s
 }
 
 func (s *Server) registerRoutes() {
-	// Route to test that the token is valid and that the backend is working properly
+	// Route to test that the token is valid and that the backend is working properly.
+	// Any valid token can be tested, regardless of its scopes.
 	s.Handle("GET /ping",
-		middleware.Auth(s.tr, func(w http.ResponseWriter, r *http.Request) {
+		middleware.Auth(s.tr, s.Usage, "", func(w http.ResponseWriter, r *http.Request) {
 			w.Header().Set("Content-Type", "text/plain")
 			w.Write([]byte("pong"))
 		}),
 	)
 
-	// All those routes use the same set of middlewares (auth + json response)
-	routes := map[string]middleware.ErrorHandler{
-		"GET /subscriptions/{id}":          s.getSingleSubscription,
-		"GET /subscriptions":               s.getSubscriptions,
-		"GET /feedinfo":                    s.fetchFeedInfo,
-		"POST /subscribe":                  s.subscribe,
-		"GET /subscriptions/{id}/articles": s.getArticles,
-		"GET /articles/{id}":               s.getSingleArticle,
-		"POST /articles/{id}/markread":     s.markArticleAsRead,
-		"POST /articles/{id}/readlater":    s.addToReadLater,
-		"DELETE /articles/{id}/readlater":  s.removeFromReadLater,
-		"GET /readlater":                   s.showReadLater,
-		"GET /unread":                      s.getUnreadArticles,
-		"POST /refresh":                    s.refresh,
+	// Logging in is how a token is obtained, so it's the only route that doesn't require one
+	s.Handle("POST /auth/login",
+		middleware.Json(middleware.Error(s.login)),
+	)
+
+	// OPML export responds with XML, so it doesn't go through the json middleware
+	s.Handle("GET /export/opml",
+		middleware.Auth(s.tr, s.Usage, token.ScopeRead, middleware.Error(s.exportOPML)),
+	)
+
+	// All those routes use the same set of middlewares (auth + json response), and are grouped by the scope they require
+	routes := map[token.Scope]map[string]middleware.ErrorHandler{
+		// Any valid token can log itself out or replace itself
+		"": {
+			"POST /auth/logout": s.logout,
+			"POST /auth/rotate": s.rotate,
+		},
+		token.ScopeRead: {
+			"GET /subscriptions/{id}":          s.getSingleSubscription,
+			"GET /subscriptions":               s.getSubscriptions,
+			"GET /feedinfo":                    s.fetchFeedInfo,
+			"GET /subscriptions/{id}/articles": s.getArticles,
+			"GET /articles/{id}":               s.getSingleArticle,
+			"GET /articles/{id}/revisions":     s.getArticleRevisions,
+			"GET /readlater":                   s.showReadLater,
+			"GET /starred":                     s.showStarred,
+			"GET /unread":                      s.getUnreadArticles,
+			"GET /search":                      s.search,
+			"GET /folders":                     s.getFolders,
+			"GET /folders/{id}":                s.getSingleFolder,
+			"GET /folders/{id}/articles":       s.getFolderArticles,
+		},
+		token.ScopeWrite: {
+			"PATCH /subscriptions/{id}":       s.updateSubscription,
+			"DELETE /subscriptions/{id}":      s.unsubscribe,
+			"POST /subscribe":                 s.subscribe,
+			"POST /articles/{id}/markread":    s.markArticleAsRead,
+			"POST /articles/{id}/markunread":  s.markArticleAsUnread,
+			"POST /articles/{id}/markseen":    s.markArticleAsSeen,
+			"POST /markread":                  s.markManyAsRead,
+			"POST /articles/{id}/readlater":   s.addToReadLater,
+			"DELETE /articles/{id}/readlater": s.removeFromReadLater,
+			"POST /articles/{id}/star":        s.starArticle,
+			"DELETE /articles/{id}/star":      s.unstarArticle,
+			"POST /refresh":                   s.refresh,
+			"POST /folders":                   s.createFolder,
+			"PATCH /folders/{id}":             s.updateFolder,
+			"DELETE /folders/{id}":            s.deleteFolder,
+			"POST /import/opml":               s.importOPML,
+		},
+		token.ScopeAdmin: {
+			"GET /tokens":         s.getTokens,
+			"POST /tokens":        s.createToken,
+			"DELETE /tokens/{id}": s.revokeToken,
+		},
 	}
 
-	for p, r := range routes {
-		s.Handle(p,
-			middleware.Json(middleware.Auth(s.tr, middleware.Error(r))),
-		)
+	for scope, group := range routes {
+		for p, r := range group {
+			s.Handle(p,
+				middleware.Json(middleware.Auth(s.tr, s.Usage, scope, middleware.Error(r))),
+			)
+		}
 	}
 }
+
+// jsonError writes an error in the same form as middleware.Error does, but with a custom status code.
+func jsonError(w http.ResponseWriter, status int, message string) {
+	res, _ := json.Marshal(middleware.ServerError{
+		Error:   true,
+		Message: message,
+	})
+
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	w.WriteHeader(status)
+	w.Write(res)
+}
+
+// userId returns the id of the user making the request, from the token set in the context by middleware.Auth.
+// Handlers only ever read or change the data of this user.
+func userId(r *http.Request) int64 {
+	return r.Context().Value(token.TokenContextKey).(token.Token).UserId
+}
@@ -5,6 +5,7 @@ import (
 	"net/http"
 	"net/http/httptest"
 	"os"
+	"strings"
 	"testing"
 
 	"github.com/3elDU/rss-reader-backend/database"
@@ -30,6 +31,70 @@ func EnableAuthForThisTest() func() {
 	}
 }
 
+// newIsolatedServer creates a server backed by its own in-memory database,
+// for tests that shouldn't share state with the rest.
+// Requests to the feeds are answered from the mocked responses.
+func newIsolatedServer(t *testing.T, mocked map[string]mockResponse) (*httptest.Server, *sqlx.DB) {
+	godb, err := database.NewWithMigrations(":memory:", "../database/migrations")
+	if err != nil {
+		t.Fatal(err)
+	}
+	db := sqlx.NewDb(godb, "sqlite")
+
+	s := server.NewServer(db, nil)
+	s.Parser.Client = &http.Client{
+		Transport: &mockRoundTripper{t, mocked},
+	}
+
+	ts := httptest.NewServer(s)
+	t.Cleanup(func() {
+		ts.Close()
+		db.Close()
+	})
+
+	return ts, db
+}
+
+// doRequest sends a request with an optional json body, and returns the response status code and body.
+func doRequest(t *testing.T, method, url, body string) (int, string) {
+	t.Helper()
+	return authorizedRequest(t, "", method, url, body)
+}
+
+// authorizedRequest is like doRequest, but authorizes the request with the token, unless it is empty.
+func authorizedRequest(t *testing.T, tok, method, url, body string) (int, string) {
+	t.Helper()
+
+	var reader io.Reader
+	if body != "" {
+		reader = strings.NewReader(body)
+	}
+
+	req, err := http.NewRequest(method, url, reader)
+	if err != nil {
+		t.Fatalf("failed to create request: %v", err)
+	}
+	if body != "" {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	if tok != "" {
+		req.Header.Set("Authorization", "Bearer "+tok)
+	}
+
+	res, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("%v %v failed: %v", method, url, err)
+	}
+	defer res.Body.Close()
+
+	resBody, err := io.ReadAll(res.Body)
+	if err != nil {
+		t.Fatalf("failed to read response body: %v", err)
+	}
+
+	return res.StatusCode, string(resBody)
+}
+
 func TestMain(t *testing.M) {
 	// Create an in-memory DB
 	godb, err := database.NewWithMigrations(":memory:", "../database/migrations")
@@ -68,14 +133,16 @@ func TestPingAuthorized(t *testing.T) {
 	defer EnableAuthForThisTest()()
 
 	// Create an authentication token
-	tok := token.New(nil).ToModel()
+	raw := token.New(nil)
+	raw.UserId = database.DefaultUserId
+	tok := raw.ToModel()
 	tokrepo := database.NewTokenRepository(TestDB)
 	if err := tokrepo.Insert(&tok); err != nil {
 		t.Errorf("error writing token to database: %v", err)
 	}
 
 	req, _ := http.NewRequest("GET", TestServer.URL+"/ping", nil)
-	req.Header.Set("Authorization", "Bearer "+tok.Token)
+	req.Header.Set("Authorization", "Bearer "+raw.Token)
 
 	res, err := http.DefaultClient.Do(req)
 	if err != nil {
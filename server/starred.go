@@ -0,0 +1,67 @@
+package server
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+
+	"github.com/3elDU/rss-reader-backend/resource"
+)
+
+func (s *Server) starArticle(w http.ResponseWriter, r *http.Request) error {
+	id, err := strconv.Atoi(r.PathValue("id"))
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		return nil
+	}
+
+	a, err := s.ar.FindForUser(userId(r), int64(id))
+	if err != nil {
+		return err
+	}
+
+	if err := s.ar.Star(userId(r), &a.Article); err != nil {
+		return err
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+	return nil
+}
+
+func (s *Server) unstarArticle(w http.ResponseWriter, r *http.Request) error {
+	id, err := strconv.Atoi(r.PathValue("id"))
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		return nil
+	}
+
+	a, err := s.ar.FindForUser(userId(r), int64(id))
+	if err != nil {
+		return err
+	}
+
+	// Responds with 404 if the article wasn't starred
+	if err := s.ar.Unstar(userId(r), &a.Article); err != nil {
+		return err
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+	return nil
+}
+
+func (s *Server) showStarred(w http.ResponseWriter, r *http.Request) error {
+	page, err := parsePage(r)
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		return nil
+	}
+
+	as, next, err := s.ar.InStarred(userId(r), page)
+	if err != nil {
+		return err
+	}
+
+	enc, _ := json.Marshal(resource.NewArticlePage(as, next))
+	w.Write(enc)
+	return nil
+}
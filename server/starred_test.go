@@ -0,0 +1,102 @@
+package server_test
+
+import (
+	"encoding/json"
+	"net/http"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestStarred(t *testing.T) {
+	ts, db := newIsolatedServer(t, map[string]mockResponse{
+		"https://example.com/rss.xml": {200, `<?xml version="1.0" encoding="UTF-8"?>
+			<rss version="2.0">
+				<channel>
+					<title>Test Feed</title>
+					<item>
+						<title>First</title>
+						<link>https://example.com/first</link>
+						<pubDate>Tue, 24 Dec 2024 02:00:00 GMT</pubDate>
+					</item>
+					<item>
+						<title>Second</title>
+						<link>https://example.com/second</link>
+						<pubDate>Tue, 24 Dec 2024 01:00:00 GMT</pubDate>
+					</item>
+				</channel>
+			</rss>`,
+		},
+	})
+
+	if status, body := doRequest(t, "POST", ts.URL+"/subscribe", `{"url": "https://example.com/rss.xml"}`); status != http.StatusCreated {
+		t.Fatalf("failed to subscribe: %v %v", status, body)
+	}
+
+	requests := []struct {
+		method, path string
+		status       int
+	}{
+		{"POST", "/articles/1/star", http.StatusNoContent},
+		{"POST", "/articles/2/star", http.StatusNoContent},
+		{"POST", "/articles/2/readlater", http.StatusNoContent},
+		// Reading clears the read later list, but not the stars
+		{"POST", "/articles/1/markread", http.StatusOK},
+		{"POST", "/articles/2/markread", http.StatusOK},
+		{"DELETE", "/articles/2/star", http.StatusNoContent},
+		{"DELETE", "/articles/2/star", http.StatusNotFound},
+		{"POST", "/articles/42/star", http.StatusNotFound},
+		{"POST", "/articles/x/star", http.StatusBadRequest},
+	}
+
+	for _, r := range requests {
+		if status, body := doRequest(t, r.method, ts.URL+r.path, ""); status != r.status {
+			t.Errorf("%v %v: bad http status code: want %v, got %v %v", r.method, r.path, r.status, status, body)
+		}
+	}
+
+	// Starring an article again keeps the original time
+	if _, err := db.Exec("UPDATE user_articles SET starred_at = '2025-01-01 00:00:00' WHERE article_id = 1"); err != nil {
+		t.Fatal(err)
+	}
+	if status, body := doRequest(t, "POST", ts.URL+"/articles/1/star", ""); status != http.StatusNoContent {
+		t.Fatalf("failed to star the article: %v %v", status, body)
+	}
+
+	type starred struct {
+		Id        int64  `json:"id"`
+		Starred   bool   `json:"starred"`
+		StarredAt string `json:"starredAt"`
+		ReadLater bool   `json:"readLater"`
+	}
+
+	status, body := doRequest(t, "GET", ts.URL+"/starred", "")
+	if status != http.StatusOK {
+		t.Fatalf("bad http status code: want 200, got %v %v", status, body)
+	}
+	p := struct {
+		Items []starred `json:"items"`
+	}{}
+	if err := json.Unmarshal([]byte(body), &p); err != nil {
+		t.Fatalf("failed to decode response: %v", err)
+	}
+
+	want := []starred{{1, true, "2025-01-01 00:00:00", false}}
+	if diff := cmp.Diff(want, p.Items); diff != "" {
+		t.Errorf("unexpected starred articles (-want +got):\n%v", diff)
+	}
+
+	// Deleting the subscription would drop the starred article, so it has to be forced
+	if status, body := doRequest(t, "DELETE", ts.URL+"/subscriptions/1", ""); status != http.StatusConflict {
+		t.Errorf("deleting should not drop the starred articles: want 409, got %v %v", status, body)
+	}
+	if status, body := doRequest(t, "DELETE", ts.URL+"/subscriptions/1?force=maybe", ""); status != http.StatusBadRequest {
+		t.Errorf("bad http status code: want 400, got %v %v", status, body)
+	}
+	if status, body := doRequest(t, "DELETE", ts.URL+"/subscriptions/1?force=true", ""); status != http.StatusNoContent {
+		t.Fatalf("failed to delete the subscription: %v %v", status, body)
+	}
+	if status, body := doRequest(t, "GET", ts.URL+"/starred", ""); status != http.StatusOK || body != `{"items":[]}` {
+		t.Errorf("starred articles should be dropped along with the subscription: %v %v", status, body)
+	}
+}
@@ -3,7 +3,9 @@
 package server
 
 import (
+	"database/sql"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"log"
 	"net/http"
@@ -16,7 +18,21 @@ import (
 )
 
 func (s *Server) getSubscriptions(w http.ResponseWriter, r *http.Request) error {
-	sms, err := s.sr.All()
+	var sms []database.Subscription
+	var err error
+
+	// Optionally, filter subscriptions by whether their last refresh failed
+	switch r.URL.Query().Get("status") {
+	case "":
+		sms, err = s.sr.ForUser(userId(r))
+	case "failing":
+		sms, err = s.sr.WithStatus(userId(r), true)
+	case "ok":
+		sms, err = s.sr.WithStatus(userId(r), false)
+	default:
+		jsonError(w, http.StatusBadRequest, "status must be either 'failing' or 'ok'")
+		return nil
+	}
 	if err != nil {
 		return err
 	}
@@ -40,7 +56,7 @@ func (s *Server) getSingleSubscription(w http.ResponseWriter, r *http.Request) e
 		return nil
 	}
 
-	sm, err := s.sr.Find(int64(id))
+	sm, err := s.sr.FindForUser(userId(r), int64(id))
 	if err != nil {
 		return err
 	}
@@ -51,11 +67,42 @@ func (s *Server) getSingleSubscription(w http.ResponseWriter, r *http.Request) e
 	return nil
 }
 
+func (s *Server) unsubscribe(w http.ResponseWriter, r *http.Request) error {
+	id, err := strconv.Atoi(r.PathValue("id"))
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		return nil
+	}
+
+	// Starred articles are kept permanently, so they are only dropped when asked for explicitly
+	force := false
+	if v := r.URL.Query().Get("force"); v != "" {
+		if force, err = strconv.ParseBool(v); err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			return nil
+		}
+	}
+
+	// The feed itself is deleted only when nobody else is subscribed to it
+	err = s.sr.Unsubscribe(userId(r), int64(id), force)
+	if errors.Is(err, database.ErrStarredArticles) {
+		jsonError(w, http.StatusConflict, "the subscription has starred articles, unstar them or unsubscribe with ?force=true to drop them")
+		return nil
+	} else if err != nil {
+		return err
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+	return nil
+}
+
 type SubscribeRequest struct {
 	URL string `json:"url" validate:"required,http_url"`
 	// Optional title and description which override those from the feed
 	Title       string `json:"title"`
 	Description string `json:"description"`
+	// Optional id of the folder to put the subscription in
+	FolderId int64 `json:"folderId"`
 }
 
 func (s *Server) subscribe(w http.ResponseWriter, r *http.Request) error {
@@ -74,13 +121,29 @@ func (s *Server) subscribe(w http.ResponseWriter, r *http.Request) error {
 	}
 	url := body.URL
 
+	if body.FolderId != 0 {
+		if ex, err := s.folderExists(userId(r), body.FolderId); err != nil {
+			return err
+		} else if !ex {
+			jsonError(w, http.StatusBadRequest, "folder does not exist")
+			return nil
+		}
+	}
+
 	ex, id, err := s.sr.SubscriptionExists(url)
 	if err != nil {
 		return err
 	}
 
-	// Return early if the subscription already exists in the database
+	subscribed := false
 	if ex {
+		if subscribed, err = s.sr.IsSubscribed(userId(r), id); err != nil {
+			return err
+		}
+	}
+
+	// Return early if the user is already subscribed to the feed
+	if subscribed {
 		w.Header().Set(
 			"Location",
 			fmt.Sprintf("/subscriptions/%v", id),
@@ -89,20 +152,74 @@ func (s *Server) subscribe(w http.ResponseWriter, r *http.Request) error {
 		return nil
 	}
 
-	gf, err := s.Parser.ParseURL(url)
-	if err != nil {
+	sr, err := s.createSubscription(userId(r), url, body.Title, body.Description, body.FolderId)
+	if herr, ok := err.(gofeed.HTTPError); ok && herr.StatusCode == 404 {
 		log.Printf("failed to fetch remote feed: %v", err)
+		http.Error(
+			w,
+			`{"error":true,"message":"404 when fetching a remote feed"}`,
+			http.StatusBadRequest,
+		)
+		return nil
+	} else if err != nil {
+		return err
+	}
 
-		if err, ok := err.(gofeed.HTTPError); ok && err.StatusCode == 404 {
-			http.Error(
-				w,
-				`{"error":true,"message":"404 when fetching a remote feed"}`,
-				http.StatusBadRequest,
-			)
-			return nil
-		} else {
-			return err
+	enc, _ := json.Marshal(sr)
+	w.WriteHeader(http.StatusCreated)
+	w.Write(enc)
+	return nil
+}
+
+// createSubscription subscribes the user to the feed at the url.
+// The feed is fetched and stored along with its articles only if nobody is subscribed to it yet.
+// Title and description override those from the feed for this user, if they are not empty.
+// If the folder id is not zero, the subscription is put into that folder.
+func (s *Server) createSubscription(userId int64, url, title, description string, folderId int64) (*resource.Subscription, error) {
+	ex, id, err := s.sr.SubscriptionExists(url)
+	if err != nil {
+		return nil, err
+	}
+
+	var sm *database.Subscription
+	if ex {
+		if sm, err = s.sr.Find(id); err != nil {
+			return nil, err
 		}
+	} else if sm, err = s.storeFeed(url); err != nil {
+		return nil, err
+	}
+
+	if err := s.sr.Subscribe(userId, sm); err != nil {
+		return nil, err
+	}
+
+	o := database.SubscriptionOverrides{}
+	if title != "" {
+		o.Title = &title
+	}
+	if description != "" {
+		o.Description = &description
+	}
+	if err := s.sr.Override(userId, sm, o); err != nil {
+		return nil, err
+	}
+
+	if folderId != 0 {
+		if err := s.sr.SetFolder(userId, sm, sql.NullInt64{Valid: true, Int64: folderId}); err != nil {
+			return nil, err
+		}
+	}
+
+	sr := resource.NewSubscription(*sm)
+	return &sr, nil
+}
+
+// storeFeed fetches the feed from the url, and stores it in the database along with its articles.
+func (s *Server) storeFeed(url string) (*database.Subscription, error) {
+	gf, err := s.Parser.ParseURL(url)
+	if err != nil {
+		return nil, err
 	}
 
 	sr := resource.NewSubscriptionFromGofeed(*gf)
@@ -111,19 +228,10 @@ func (s *Server) subscribe(w http.ResponseWriter, r *http.Request) error {
 	// Overwrite the URL to the one pointing at the actual feed
 	sr.Url = url
 
-	// Override title and description with those from the request, if they are set
-	if body.Title != "" {
-		sr.Title = body.Title
-	}
-	if body.Description != "" {
-		sr.Description = body.Description
-	}
-
 	sm := sr.ToModel()
 	if err := s.sr.InsertSubscription(&sm); err != nil {
-		return err
+		return nil, err
 	}
-	sr.Id = sm.ID
 
 	articles := resource.NewArticlesFromGofeed(gf.Items, sm.ID)
 	aModels := []database.Article{}
@@ -131,12 +239,123 @@ func (s *Server) subscribe(w http.ResponseWriter, r *http.Request) error {
 		aModels = append(aModels, article.ToModel())
 	}
 
-	if err := s.ar.BulkAddArticles(aModels); err != nil {
+	if _, _, err := s.ar.BulkAddArticles(aModels); err != nil {
+		return nil, err
+	}
+
+	return &sm, nil
+}
+
+type UpdateSubscriptionRequest struct {
+	// New URL of the feed. It is fetched before saving, to make sure it points to a valid feed.
+	URL         *string `json:"url" validate:"omitnil,http_url"`
+	Title       *string `json:"title" validate:"omitnil,min=1"`
+	Description *string `json:"description"`
+	Thumbnail   *string `json:"thumbnail"`
+	// Id of the folder to move the subscription to. Zero removes the subscription from its folder.
+	FolderId *int64 `json:"folderId"`
+}
+
+func (s *Server) updateSubscription(w http.ResponseWriter, r *http.Request) error {
+	id, err := strconv.Atoi(r.PathValue("id"))
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		return nil
+	}
+
+	body := UpdateSubscriptionRequest{}
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		log.Printf("invalid json: %v", err)
+		w.WriteHeader(http.StatusBadRequest)
+		return nil
+	}
+
+	if err := s.v.Struct(&body); err != nil {
+		log.Printf("validate error: %v", err)
+		w.WriteHeader(http.StatusBadRequest)
+		return nil
+	}
+
+	uid := userId(r)
+	sm, err := s.sr.FindForUser(uid, int64(id))
+	if err != nil {
 		return err
 	}
 
-	enc, _ := json.Marshal(sr)
-	w.WriteHeader(http.StatusCreated)
+	if body.FolderId != nil && *body.FolderId != 0 {
+		if ex, err := s.folderExists(uid, *body.FolderId); err != nil {
+			return err
+		} else if !ex {
+			jsonError(w, http.StatusBadRequest, "folder does not exist")
+			return nil
+		}
+	}
+
+	if body.URL != nil && *body.URL != sm.Url {
+		ex, other, err := s.sr.SubscriptionExists(*body.URL)
+		if err != nil {
+			return err
+		}
+		if ex && other != sm.ID {
+			jsonError(w, http.StatusConflict, fmt.Sprintf("subscription %v already uses this url", other))
+			return nil
+		}
+
+		// The feed is shared, so its url can't be changed from under the other users
+		if n, err := s.sr.Subscribers(sm.ID); err != nil {
+			return err
+		} else if n > 1 {
+			jsonError(w, http.StatusConflict, "other users are subscribed to this feed, subscribe to the new url instead")
+			return nil
+		}
+
+		gf, err := s.Parser.ParseURL(*body.URL)
+		if err != nil {
+			log.Printf("failed to fetch remote feed: %v", err)
+
+			if err, ok := err.(gofeed.HTTPError); ok {
+				jsonError(w, http.StatusBadRequest, fmt.Sprintf("%v when fetching a remote feed", err.StatusCode))
+			} else {
+				jsonError(w, http.StatusBadRequest, "failed to parse a remote feed")
+			}
+			return nil
+		}
+
+		// The feed is updated without the overrides of the user
+		feed, err := s.sr.Find(sm.ID)
+		if err != nil {
+			return err
+		}
+		feed.Url = *body.URL
+		feed.Type = gf.FeedType
+		feed.Link = sql.NullString{Valid: gf.Link != "", String: gf.Link}
+		// Cached headers belong to the old url
+		feed.ETag = sql.NullString{}
+		feed.LastModified = sql.NullString{}
+
+		if err := s.sr.UpdateSubscription(*feed); err != nil {
+			return err
+		}
+		sm.Url, sm.Type, sm.Link = feed.Url, feed.Type, feed.Link
+	}
+
+	// Title, description and thumbnail are only changed for this user
+	err = s.sr.Override(uid, sm, database.SubscriptionOverrides{
+		Title:       body.Title,
+		Description: body.Description,
+		Thumbnail:   body.Thumbnail,
+	})
+	if err != nil {
+		return err
+	}
+
+	if body.FolderId != nil {
+		if err := s.sr.SetFolder(uid, sm, sql.NullInt64{Valid: *body.FolderId != 0, Int64: *body.FolderId}); err != nil {
+			return err
+		}
+	}
+
+	enc, _ := json.Marshal(resource.NewSubscription(*sm))
 	w.Write(enc)
 	return nil
 }
@@ -165,13 +384,19 @@ func (s *Server) fetchFeedInfo(w http.ResponseWriter, r *http.Request) error {
 	// Overwrite the URL to the one pointing at the actual feed
 	res.Url = feedUrl
 
-	// Check if feed with the specified URL already exists in the database
-	if exists, id, err := s.sr.SubscriptionExists(f.Link); err == nil && exists {
-		// Populate feed with it's ID in the database
-		// Clients then can check, if the id != 0, then the feed already exists in the database
-		res.Id = id
-	} else if err != nil {
+	// Check if the user is already subscribed to the feed with the specified URL
+	if exists, id, err := s.sr.SubscriptionExists(f.Link); err != nil {
 		return err
+	} else if exists {
+		subscribed, err := s.sr.IsSubscribed(userId(r), id)
+		if err != nil {
+			return err
+		}
+		// Populate feed with it's ID in the database
+		// Clients then can check, if the id != 0, then the user is already subscribed
+		if subscribed {
+			res.Id = id
+		}
 	}
 
 	enc, _ := json.Marshal(res)
@@ -63,6 +63,22 @@ func TestSubscriptionRoutes(t *testing.T) {
 					</rss>`,
 				},
 				"https://example.com/404.xml": {404, "404 not found"},
+				"https://example.com/other.xml": {200, `<?xml version="1.0" encoding="UTF-8"?>
+					<rss version="2.0">
+						<channel>
+							<title>Other Feed</title>
+							<link>https://example.com/other</link>
+						</channel>
+					</rss>`,
+				},
+				"https://example.com/moved.xml": {200, `<?xml version="1.0" encoding="UTF-8"?>
+					<rss version="2.0">
+						<channel>
+							<title>Moved Feed</title>
+							<link>https://example.com/moved</link>
+						</channel>
+					</rss>`,
+				},
 			},
 		},
 	}
@@ -71,7 +87,7 @@ func TestSubscriptionRoutes(t *testing.T) {
 		name   string
 		method string
 		path   string
-		// Used only when method == "POST"
+		// Request body, can be nil
 		postBody io.Reader
 		// Status code to expect
 		statusCode int
@@ -84,7 +100,7 @@ func TestSubscriptionRoutes(t *testing.T) {
 			"/subscribe",
 			strings.NewReader(`{"url": "https://example.com/rss.xml"}`),
 			http.StatusCreated,
-			`{"id":1,"type":"rss","url":"https://example.com/rss.xml","title":"Test Feed","description":"Test feed for testing"}`,
+			`{"id":1,"type":"rss","url":"https://example.com/rss.xml","title":"Test Feed","description":"Test feed for testing","link":"https://example.com"}`,
 		},
 		{
 			"get feed by id",
@@ -92,7 +108,7 @@ func TestSubscriptionRoutes(t *testing.T) {
 			"/subscriptions/1",
 			nil,
 			200,
-			`{"id":1,"type":"rss","url":"https://example.com/rss.xml","title":"Test Feed","description":"Test feed for testing"}`,
+			`{"id":1,"type":"rss","url":"https://example.com/rss.xml","title":"Test Feed","description":"Test feed for testing","link":"https://example.com"}`,
 		},
 		{
 			"get all feeds",
@@ -100,7 +116,7 @@ func TestSubscriptionRoutes(t *testing.T) {
 			"/subscriptions",
 			nil,
 			200,
-			`[{"id":1,"type":"rss","url":"https://example.com/rss.xml","title":"Test Feed","description":"Test feed for testing"}]`,
+			`[{"id":1,"type":"rss","url":"https://example.com/rss.xml","title":"Test Feed","description":"Test feed for testing","link":"https://example.com"}]`,
 		},
 		{
 			"get subscriptions articles",
@@ -108,7 +124,7 @@ func TestSubscriptionRoutes(t *testing.T) {
 			"/subscriptions/1/articles",
 			nil,
 			200,
-			`[{"id":1,"subscriptionId":1,"new":true,"url":"https://example.com/test-article","title":"Test Article","description":"Test article description","created":"2024-12-24 00:00:00","readLater":false,"subscription":{"id":1,"type":"rss","url":"https://example.com/rss.xml","title":"Test Feed","description":"Test feed for testing"}}]`,
+			`{"items":[{"id":1,"subscriptionId":1,"new":true,"url":"https://example.com/test-article","title":"Test Article","description":"Test article description","created":"2024-12-24 00:00:00","readLater":false,"guid":"https://example.com/test-article","seen":false,"starred":false,"subscription":{"id":1,"type":"rss","url":"https://example.com/rss.xml","title":"Test Feed","description":"Test feed for testing","link":"https://example.com"}}]}`,
 		},
 		{
 			"proper 404 handling",
@@ -118,22 +134,123 @@ func TestSubscriptionRoutes(t *testing.T) {
 			400,
 			"{\"error\":true,\"message\":\"404 when fetching a remote feed\"}\n",
 		},
+		{
+			"subscribe to another feed",
+			"POST",
+			"/subscribe",
+			strings.NewReader(`{"url": "https://example.com/other.xml"}`),
+			http.StatusCreated,
+			`{"id":2,"type":"rss","url":"https://example.com/other.xml","title":"Other Feed","link":"https://example.com/other"}`,
+		},
+		{
+			"rename feed",
+			"PATCH",
+			"/subscriptions/1",
+			strings.NewReader(`{"title": "Renamed Feed", "thumbnail": "https://example.com/icon.png"}`),
+			200,
+			`{"id":1,"type":"rss","url":"https://example.com/rss.xml","title":"Renamed Feed","description":"Test feed for testing","thumbnail":"https://example.com/icon.png","link":"https://example.com"}`,
+		},
+		{
+			"reject empty title",
+			"PATCH",
+			"/subscriptions/1",
+			strings.NewReader(`{"title": ""}`),
+			http.StatusBadRequest,
+			"",
+		},
+		{
+			"reject url used by another feed",
+			"PATCH",
+			"/subscriptions/1",
+			strings.NewReader(`{"url": "https://example.com/other.xml"}`),
+			http.StatusConflict,
+			`{"error":true,"message":"subscription 2 already uses this url"}`,
+		},
+		{
+			"reject url that is not a feed",
+			"PATCH",
+			"/subscriptions/2",
+			strings.NewReader(`{"url": "https://example.com/404.xml"}`),
+			http.StatusBadRequest,
+			`{"error":true,"message":"404 when fetching a remote feed"}`,
+		},
+		{
+			"change feed url",
+			"PATCH",
+			"/subscriptions/2",
+			strings.NewReader(`{"url": "https://example.com/moved.xml", "description": "Moved somewhere else"}`),
+			200,
+			`{"id":2,"type":"rss","url":"https://example.com/moved.xml","title":"Other Feed","description":"Moved somewhere else","link":"https://example.com/moved"}`,
+		},
+		{
+			"update missing feed",
+			"PATCH",
+			"/subscriptions/42",
+			strings.NewReader(`{"title": "Nope"}`),
+			http.StatusNotFound,
+			"",
+		},
+		{
+			"add article to read later",
+			"POST",
+			"/articles/1/readlater",
+			nil,
+			http.StatusNoContent,
+			"",
+		},
+		{
+			"unsubscribe",
+			"DELETE",
+			"/subscriptions/1",
+			nil,
+			http.StatusNoContent,
+			"",
+		},
+		{
+			"unsubscribed feed is gone",
+			"GET",
+			"/subscriptions/1",
+			nil,
+			http.StatusNotFound,
+			"",
+		},
+		{
+			"articles are deleted along with the feed",
+			"GET",
+			"/articles/1",
+			nil,
+			http.StatusNotFound,
+			"",
+		},
+		{
+			"read later list is cleaned up",
+			"GET",
+			"/readlater",
+			nil,
+			200,
+			`{"items":[]}`,
+		},
+		{
+			"unsubscribe from a missing feed",
+			"DELETE",
+			"/subscriptions/1",
+			nil,
+			http.StatusNotFound,
+			"",
+		},
 	}
 
 	for _, test := range tests {
 		t.Run(test.name, func(t *testing.T) {
-			var resp *http.Response
-			var err error
-
-			if test.method == "GET" {
-				resp, err = http.Get(TestServer.URL + test.path)
-			} else if test.method == "POST" {
-				resp, err = http.Post(
-					TestServer.URL+test.path,
-					"application/json",
-					test.postBody,
-				)
+			req, err := http.NewRequest(test.method, TestServer.URL+test.path, test.postBody)
+			if err != nil {
+				t.Fatalf("failed to create request: %v", err)
+			}
+			if test.postBody != nil {
+				req.Header.Set("Content-Type", "application/json")
 			}
+
+			resp, err := http.DefaultClient.Do(req)
 			if err != nil {
 				t.Fatalf("http request failed: %v", err)
 			}
@@ -159,3 +276,48 @@ func TestSubscriptionRoutes(t *testing.T) {
 		})
 	}
 }
+
+func TestSubscriptionStatusFilter(t *testing.T) {
+	ts, db := newIsolatedServer(t, map[string]mockResponse{
+		"https://example.com/rss.xml":   {200, `<rss version="2.0"><channel><title>Working</title></channel></rss>`},
+		"https://example.com/other.xml": {200, `<rss version="2.0"><channel><title>Broken</title></channel></rss>`},
+	})
+
+	for _, url := range []string{"https://example.com/rss.xml", "https://example.com/other.xml"} {
+		if status, body := doRequest(t, "POST", ts.URL+"/subscribe", `{"url": "`+url+`"}`); status != http.StatusCreated {
+			t.Fatalf("failed to subscribe: %v %v", status, body)
+		}
+	}
+
+	_, err := db.Exec(`UPDATE subscriptions SET
+		failure_count = 3, last_status = 500, last_error = 'http error: 500', last_attempt_at = '2024-12-24 00:00:00'
+		WHERE id = 2`,
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		query      string
+		statusCode int
+		response   string
+	}{
+		{
+			"?status=failing", 200,
+			`[{"id":2,"type":"rss","url":"https://example.com/other.xml","title":"Broken","lastAttemptAt":"2024-12-24 00:00:00","failureCount":3,"lastStatus":500,"lastError":"http error: 500"}]`,
+		},
+		{"?status=ok", 200, `[{"id":1,"type":"rss","url":"https://example.com/rss.xml","title":"Working"}]`},
+		{"?status=unknown", 400, `{"error":true,"message":"status must be either 'failing' or 'ok'"}`},
+	}
+
+	for _, test := range tests {
+		status, body := doRequest(t, "GET", ts.URL+"/subscriptions"+test.query, "")
+		if status != test.statusCode {
+			t.Errorf("%v: bad http status code: want %v, got %v", test.query, test.statusCode, status)
+		}
+
+		if diff := cmp.Diff(test.response, body); diff != "" {
+			t.Errorf("%v: unexpected response body (-want +got):\n%v", test.query, diff)
+		}
+	}
+}
@@ -0,0 +1,149 @@
+// Token management routes
+
+package server
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/3elDU/rss-reader-backend/resource"
+	"github.com/3elDU/rss-reader-backend/token"
+)
+
+type CreateTokenRequest struct {
+	Label string `json:"label" validate:"max=100"`
+	// For how long the token will be valid, in the Go duration format, like "720h". Empty means no expiration.
+	ValidFor string `json:"validFor"`
+	// Inactivity after which the token expires, in the Go duration format, like "168h". Can't be used together with ValidFor.
+	IdleTimeout string `json:"idleTimeout"`
+	// Scopes of the new token, like ["read"]. Defaults to the scopes of the token making the request.
+	Scopes []string `json:"scopes"`
+}
+
+// getTokens lists the tokens of the user, without the tokens themselves
+func (s *Server) getTokens(w http.ResponseWriter, r *http.Request) error {
+	tms, err := s.tr.ForUser(userId(r))
+	if err != nil {
+		return err
+	}
+
+	trs := make([]resource.Token, len(tms))
+	for i, tm := range tms {
+		trs[i] = resource.NewToken(token.FromModel(tm))
+	}
+
+	enc, _ := json.Marshal(trs)
+	w.Write(enc)
+	return nil
+}
+
+// createToken creates a new token for the user, and responds with it. This is the only time the token itself is shown.
+func (s *Server) createToken(w http.ResponseWriter, r *http.Request) error {
+	body := CreateTokenRequest{}
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		log.Printf("invalid json: %v", err)
+		w.WriteHeader(http.StatusBadRequest)
+		return nil
+	}
+
+	if err := s.v.Struct(&body); err != nil {
+		log.Printf("validate error: %v", err)
+		w.WriteHeader(http.StatusBadRequest)
+		return nil
+	}
+
+	var validFor *time.Duration
+	if body.ValidFor != "" {
+		d, err := time.ParseDuration(body.ValidFor)
+		if err != nil || d <= 0 {
+			jsonError(w, http.StatusBadRequest, "validFor must be a positive duration, like \"720h\"")
+			return nil
+		}
+		validFor = &d
+	}
+
+	idleTimeout, ok := parseIdleTimeout(w, body.IdleTimeout, validFor != nil)
+	if !ok {
+		return nil
+	}
+
+	// A token can't grant more than it has itself
+	creator := r.Context().Value(token.TokenContextKey).(token.Token)
+	scopes := creator.Scopes
+	if body.Scopes != nil {
+		var err error
+		if scopes, err = token.ParseScopes(body.Scopes); err != nil {
+			jsonError(w, http.StatusBadRequest, err.Error())
+			return nil
+		}
+		for _, scope := range scopes {
+			if !creator.HasScope(scope) {
+				jsonError(w, http.StatusForbidden, fmt.Sprintf("can't grant the '%v' scope, the token is missing it", scope))
+				return nil
+			}
+		}
+	}
+
+	t := token.New(validFor)
+	t.UserId = creator.UserId
+	t.Label = body.Label
+	t.Scopes = scopes
+	if idleTimeout > 0 {
+		t.SetIdleTimeout(idleTimeout)
+	}
+
+	tm := t.ToModel()
+	if err := s.tr.Insert(&tm); err != nil {
+		return err
+	}
+	t.ID = tm.ID
+
+	res := resource.NewToken(*t)
+	res.Token = t.Token
+
+	enc, _ := json.Marshal(res)
+	w.WriteHeader(http.StatusCreated)
+	w.Write(enc)
+	return nil
+}
+
+// parseIdleTimeout parses the idle timeout of the token being created, which is zero if it's empty.
+// If it's invalid, the error is written and ok is false.
+func parseIdleTimeout(w http.ResponseWriter, s string, hasValidFor bool) (d time.Duration, ok bool) {
+	if s == "" {
+		return 0, true
+	}
+
+	if hasValidFor {
+		jsonError(w, http.StatusBadRequest, "validFor and idleTimeout can't be used together")
+		return 0, false
+	}
+
+	d, err := time.ParseDuration(s)
+	if err != nil || d < token.MinIdleTimeout {
+		jsonError(w, http.StatusBadRequest, "idleTimeout must be a duration of at least "+token.MinIdleTimeout.String())
+		return 0, false
+	}
+
+	return d, true
+}
+
+// revokeToken deletes the token of the user, so that it can't be used anymore
+func (s *Server) revokeToken(w http.ResponseWriter, r *http.Request) error {
+	id, err := strconv.Atoi(r.PathValue("id"))
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		return nil
+	}
+
+	if err := s.tr.DeleteForUser(userId(r), int64(id)); err != nil {
+		return err
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+	return nil
+}
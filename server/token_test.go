@@ -0,0 +1,85 @@
+package server_test
+
+import (
+	"encoding/json"
+	"net/http"
+	"testing"
+)
+
+func TestTokenManagement(t *testing.T) {
+	ts, _ := newIsolatedServer(t, nil)
+
+	type token struct {
+		Id         int64  `json:"id"`
+		Label      string `json:"label"`
+		Token      string `json:"token"`
+		CreatedAt  string `json:"createdAt"`
+		ValidUntil string `json:"validUntil"`
+	}
+
+	create := func(body string) token {
+		t.Helper()
+
+		status, res := doRequest(t, "POST", ts.URL+"/tokens", body)
+		if status != http.StatusCreated {
+			t.Fatalf("failed to create token: %v %v", status, res)
+		}
+
+		tok := token{}
+		if err := json.Unmarshal([]byte(res), &tok); err != nil {
+			t.Fatal(err)
+		}
+		return tok
+	}
+
+	// Authentication is disabled for now, so that the first tokens can be created
+	phone := create(`{"label": "phone"}`)
+	if phone.Id != 1 || phone.Label != "phone" || phone.Token == "" || phone.ValidUntil != "" {
+		t.Errorf("unexpected token: %+v", phone)
+	}
+	laptop := create(`{"label": "laptop", "validFor": "24h"}`)
+	if laptop.ValidUntil == "" {
+		t.Errorf("expected the token to expire, got %+v", laptop)
+	}
+
+	for _, body := range []string{`{"validFor": "forever"}`, `{"validFor": "-1h"}`, `not json`} {
+		if status, res := doRequest(t, "POST", ts.URL+"/tokens", body); status != http.StatusBadRequest {
+			t.Errorf("%v: bad http status code: want 400, got %v %v", body, status, res)
+		}
+	}
+
+	defer EnableAuthForThisTest()()
+
+	if status, body := doRequest(t, "GET", ts.URL+"/tokens", ""); status != http.StatusUnauthorized {
+		t.Errorf("bad http status code: want 401, got %v %v", status, body)
+	}
+
+	// Tokens are listed without the tokens themselves
+	status, body := authorizedRequest(t, laptop.Token, "GET", ts.URL+"/tokens", "")
+	if status != http.StatusOK {
+		t.Fatalf("bad http status code: want 200, got %v %v", status, body)
+	}
+	list := []token{}
+	if err := json.Unmarshal([]byte(body), &list); err != nil {
+		t.Fatal(err)
+	}
+	if len(list) != 2 || list[0].Label != "phone" || list[1].Label != "laptop" {
+		t.Errorf("unexpected tokens: %+v", list)
+	}
+	for _, tok := range list {
+		if tok.Token != "" {
+			t.Errorf("token %v was revealed in the list", tok.Id)
+		}
+	}
+
+	// Revoked token can't be used anymore
+	if status, body := authorizedRequest(t, laptop.Token, "DELETE", ts.URL+"/tokens/1", ""); status != http.StatusNoContent {
+		t.Errorf("bad http status code: want 204, got %v %v", status, body)
+	}
+	if status, body := authorizedRequest(t, phone.Token, "GET", ts.URL+"/tokens", ""); status != http.StatusUnauthorized {
+		t.Errorf("revoked token: bad http status code: want 401, got %v %v", status, body)
+	}
+	if status, body := authorizedRequest(t, laptop.Token, "DELETE", ts.URL+"/tokens/1", ""); status != http.StatusNotFound {
+		t.Errorf("bad http status code: want 404, got %v %v", status, body)
+	}
+}
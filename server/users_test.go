@@ -0,0 +1,187 @@
+package server_test
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/3elDU/rss-reader-backend/database"
+	"github.com/3elDU/rss-reader-backend/token"
+)
+
+func TestUsersAreIsolated(t *testing.T) {
+	ts, db := newIsolatedServer(t, map[string]mockResponse{
+		"https://example.com/rss.xml": {200, `<?xml version="1.0" encoding="UTF-8"?>
+			<rss version="2.0">
+				<channel>
+					<title>Test Feed</title>
+					<item>
+						<title>First</title>
+						<link>https://example.com/first</link>
+						<pubDate>Tue, 24 Dec 2024 02:00:00 GMT</pubDate>
+					</item>
+					<item>
+						<title>Second</title>
+						<link>https://example.com/second</link>
+						<pubDate>Tue, 24 Dec 2024 01:00:00 GMT</pubDate>
+					</item>
+				</channel>
+			</rss>`,
+		},
+	})
+
+	bob := database.User{Name: "bob"}
+	if err := database.NewUserRepository(db).Insert(&bob); err != nil {
+		t.Fatal(err)
+	}
+
+	// newToken creates a token for the user, and returns it along with its id
+	newToken := func(userId int64) (string, int64) {
+		t.Helper()
+
+		tok := token.New(nil)
+		tok.UserId = userId
+		tm := tok.ToModel()
+		if err := database.NewTokenRepository(db).Insert(&tm); err != nil {
+			t.Fatal(err)
+		}
+		return tok.Token, tm.ID
+	}
+	aliceToken, aliceTokenId := newToken(database.DefaultUserId)
+	bobToken, _ := newToken(bob.ID)
+
+	defer EnableAuthForThisTest()()
+
+	// Redirects are not followed, so that they can be checked
+	client := &http.Client{
+		CheckRedirect: func(*http.Request, []*http.Request) error {
+			return http.ErrUseLastResponse
+		},
+	}
+
+	// as sends a request on behalf of the user with the given token
+	as := func(tok, method, path, body string) (int, string) {
+		t.Helper()
+
+		req, err := http.NewRequest(method, ts.URL+path, strings.NewReader(body))
+		if err != nil {
+			t.Fatal(err)
+		}
+		req.Header.Set("Authorization", "Bearer "+tok)
+
+		res, err := client.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer res.Body.Close()
+
+		b, _ := io.ReadAll(res.Body)
+		return res.StatusCode, string(b)
+	}
+
+	// count returns the number of rows in the table
+	count := func(table string) (n int) {
+		t.Helper()
+
+		if err := db.Get(&n, "SELECT COUNT(*) FROM "+table); err != nil {
+			t.Fatal(err)
+		}
+		return
+	}
+
+	requests := []struct {
+		name         string
+		token        string
+		method, path string
+		body         string
+		status       int
+	}{
+		{"alice subscribes", aliceToken, "POST", "/subscribe", `{"url": "https://example.com/rss.xml"}`, 201},
+		{"bob can't see the subscription of alice", bobToken, "GET", "/subscriptions/1", ``, 404},
+		{"bob can't see the articles of alice", bobToken, "GET", "/articles/1", ``, 404},
+		{"bob can't read the articles of alice", bobToken, "POST", "/articles/1/star", ``, 404},
+		{"bob subscribes to the same feed", bobToken, "POST", "/subscribe", `{"url": "https://example.com/rss.xml", "title": "Bob's feed"}`, 201},
+		{"bob is already subscribed", bobToken, "POST", "/subscribe", `{"url": "https://example.com/rss.xml"}`, 302},
+		{"alice reads an article", aliceToken, "POST", "/articles/1/markread", ``, 200},
+		{"bob stars an article", bobToken, "POST", "/articles/2/star", ``, 204},
+		{"alice creates a folder", aliceToken, "POST", "/folders", `{"title": "News"}`, 201},
+		{"bob creates a folder with the same title", bobToken, "POST", "/folders", `{"title": "News"}`, 201},
+		{"alice can't see the folder of bob", aliceToken, "GET", "/folders/2", ``, 404},
+		{"alice can't use the folder of bob", aliceToken, "PATCH", "/subscriptions/1", `{"folderId": 2}`, 400},
+		{"bob moves the feed into his folder", bobToken, "PATCH", "/subscriptions/1", `{"folderId": 2}`, 200},
+		{"bob can't move the shared feed", bobToken, "PATCH", "/subscriptions/1", `{"url": "https://example.com/other.xml"}`, 409},
+		{"bob can't revoke the token of alice", bobToken, "DELETE", "/tokens/" + strconv.FormatInt(aliceTokenId, 10), ``, 404},
+	}
+
+	for _, r := range requests {
+		if status, body := as(r.token, r.method, r.path, r.body); status != r.status {
+			t.Errorf("%v: bad http status code: want %v, got %v %v", r.name, r.status, status, body)
+		}
+	}
+
+	// The feed and its articles are stored once
+	if subs, articles := count("subscriptions"), count("articles"); subs != 1 || articles != 2 {
+		t.Errorf("expected 1 feed with 2 articles, got %v feeds and %v articles", subs, articles)
+	}
+
+	type state struct {
+		Id      int64 `json:"id"`
+		New     bool  `json:"new"`
+		Starred bool  `json:"starred"`
+	}
+	// articles lists the articles of the subscription as seen by the user
+	articles := func(tok string) []state {
+		t.Helper()
+
+		status, body := as(tok, "GET", "/subscriptions/1/articles", "")
+		if status != http.StatusOK {
+			t.Fatalf("bad http status code: want 200, got %v %v", status, body)
+		}
+		p := struct {
+			Items []state `json:"items"`
+		}{}
+		if err := json.Unmarshal([]byte(body), &p); err != nil {
+			t.Fatal(err)
+		}
+		return p.Items
+	}
+
+	if got := articles(aliceToken); len(got) != 2 || got[0] != (state{1, false, false}) || got[1] != (state{2, true, false}) {
+		t.Errorf("unexpected articles of alice: %+v", got)
+	}
+	if got := articles(bobToken); len(got) != 2 || got[0] != (state{1, true, false}) || got[1] != (state{2, true, true}) {
+		t.Errorf("unexpected articles of bob: %+v", got)
+	}
+
+	// The title set by bob doesn't change the title seen by alice
+	if _, body := as(aliceToken, "GET", "/subscriptions/1", ""); !strings.Contains(body, `"title":"Test Feed"`) || strings.Contains(body, `"folderId":2`) {
+		t.Errorf("unexpected subscription of alice: %v", body)
+	}
+	if _, body := as(bobToken, "GET", "/subscriptions/1", ""); !strings.Contains(body, `"title":"Bob's feed"`) || !strings.Contains(body, `"folderId":2`) {
+		t.Errorf("unexpected subscription of bob: %v", body)
+	}
+
+	// The feed is deleted only after the last user unsubscribes
+	if status, body := as(aliceToken, "DELETE", "/subscriptions/1", ""); status != http.StatusNoContent {
+		t.Fatalf("failed to unsubscribe: %v %v", status, body)
+	}
+	if status, body := as(bobToken, "GET", "/subscriptions/1/articles", ""); status != http.StatusOK {
+		t.Errorf("feed was deleted while bob is still subscribed: %v %v", status, body)
+	}
+	// Bob starred an article, which would be dropped along with the subscription
+	if status, body := as(bobToken, "DELETE", "/subscriptions/1", ""); status != http.StatusConflict {
+		t.Fatalf("unsubscribing should not drop the starred articles: want 409, got %v %v", status, body)
+	}
+	if status, body := as(bobToken, "GET", "/starred", ""); status != http.StatusOK || !strings.Contains(body, `"id":2`) {
+		t.Errorf("starred article should be kept: %v %v", status, body)
+	}
+	if status, body := as(bobToken, "DELETE", "/subscriptions/1?force=true", ""); status != http.StatusNoContent {
+		t.Fatalf("failed to unsubscribe: %v %v", status, body)
+	}
+	if subs, articles := count("subscriptions"), count("articles"); subs != 0 || articles != 0 {
+		t.Errorf("expected the feed to be deleted, got %v feeds and %v articles", subs, articles)
+	}
+}
@@ -0,0 +1,63 @@
+package token
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+)
+
+// Scope is a permission carried by a token. Each route requires one scope.
+type Scope string
+
+const (
+	// Reading subscriptions, articles and folders
+	ScopeRead Scope = "read"
+	// Subscribing, changing the read state of the articles, organizing folders and refreshing the feeds
+	ScopeWrite Scope = "write"
+	// Managing the tokens
+	ScopeAdmin Scope = "admin"
+)
+
+// AllScopes gives full access. Tokens that existed before the scopes were introduced have all of them.
+var AllScopes = []Scope{ScopeRead, ScopeWrite, ScopeAdmin}
+
+// ParseScopes validates the scope names, and returns them without duplicates.
+func ParseScopes(names []string) ([]Scope, error) {
+	scopes := []Scope{}
+	for _, name := range names {
+		s := Scope(name)
+		if !slices.Contains(AllScopes, s) {
+			return nil, fmt.Errorf("unknown scope '%v'", name)
+		}
+		if !slices.Contains(scopes, s) {
+			scopes = append(scopes, s)
+		}
+	}
+
+	return scopes, nil
+}
+
+// HasScope reports whether the token carries the scope. Scopes are independent, admin doesn't imply read or write.
+func (t Token) HasScope(s Scope) bool {
+	return slices.Contains(t.Scopes, s)
+}
+
+// joinScopes encodes the scopes the way they are stored in the database, separated by spaces
+func joinScopes(scopes []Scope) string {
+	names := make([]string, len(scopes))
+	for i, s := range scopes {
+		names[i] = string(s)
+	}
+
+	return strings.Join(names, " ")
+}
+
+// splitScopes decodes the scopes stored in the database
+func splitScopes(stored string) []Scope {
+	scopes := []Scope{}
+	for _, name := range strings.Fields(stored) {
+		scopes = append(scopes, Scope(name))
+	}
+
+	return scopes
+}
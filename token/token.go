@@ -4,6 +4,7 @@ import (
 	"crypto/rand"
 	"database/sql"
 	"encoding/base64"
+	"slices"
 	"time"
 
 	"github.com/3elDU/rss-reader-backend/database"
@@ -14,25 +15,72 @@ type ContextKey string
 const TokenContextKey ContextKey = "token"
 
 type Token struct {
-	ID         int64
+	ID int64
+	// Id of the user the token belongs to. Requests made with the token act on behalf of that user.
+	UserId int64
+	// The token itself. It is only known when the token is created, since the database stores only the digest.
 	Token      string
 	CreatedAt  time.Time
 	ValidUntil time.Time
+	// Human readable name of the token. Can be empty.
+	Label string
+	// Permissions of the token, see HasScope
+	Scopes []Scope
+	// When the token was last used and by which client. Zero if it was never used.
+	LastUsedAt    time.Time
+	LastIP        string
+	LastUserAgent string
+	// Inactivity after which the token expires, see SetIdleTimeout. Zero if it only expires at ValidUntil.
+	IdleTimeout time.Duration
+	// Whether the token was replaced by a new one, and is only valid for the grace period
+	Rotated bool
+}
+
+// SetIdleTimeout makes the token expire after the given inactivity, instead of at a fixed time.
+// Each use of the token pushes ValidUntil forward, see UsageTracker.
+func (t *Token) SetIdleTimeout(d time.Duration) {
+	t.IdleTimeout = d
+	t.ValidUntil = t.CreatedAt.Add(d)
+}
+
+// Replacement generates the token that takes the place of this one when it's rotated.
+// It belongs to the same user, has the same label, scopes and idle timeout, and expires when this one would have,
+// so that rotating doesn't extend the validity. Only tokens with an idle timeout start a new window of inactivity.
+func (t Token) Replacement() *Token {
+	n := New(nil)
+	if t.IdleTimeout > 0 {
+		n.SetIdleTimeout(t.IdleTimeout)
+	} else {
+		n.ValidUntil = t.ValidUntil
+	}
+
+	n.UserId = t.UserId
+	n.Label = t.Label
+	n.Scopes = slices.Clone(t.Scopes)
+	return n
 }
 
 func (t Token) Expired() bool {
 	return !t.ValidUntil.IsZero() && t.ValidUntil.Before(time.Now().UTC())
 }
 
+// ToModel converts the token to the database model, with the digest of the token.
+// Tokens from FromModel don't know the token itself, so the caller has to set the digest on the model.
 func (t Token) ToModel() database.Token {
 	vs := ""
 	if !t.ValidUntil.IsZero() {
 		vs = t.ValidUntil.Format(time.DateTime)
 	}
 
+	th := ""
+	if t.Token != "" {
+		th = database.HashToken(t.Token)
+	}
+
 	return database.Token{
-		ID:    t.ID,
-		Token: t.Token,
+		ID:        t.ID,
+		UserId:    t.UserId,
+		TokenHash: th,
 		CreatedAt: sql.NullString{
 			String: t.CreatedAt.Format(time.DateTime),
 			Valid:  true,
@@ -41,9 +89,17 @@ func (t Token) ToModel() database.Token {
 			String: vs,
 			Valid:  !t.ValidUntil.IsZero(),
 		},
+		Label: sql.NullString{
+			String: t.Label,
+			Valid:  t.Label != "",
+		},
+		Scopes:      joinScopes(t.Scopes),
+		IdleTimeout: int64(t.IdleTimeout / time.Second),
 	}
 }
 
+// FromModel converts the database model to the token.
+// Only the digest is stored, so the Token property is left empty, see ToModel.
 func FromModel(t database.Token) Token {
 	ca, _ := time.Parse(time.DateTime, t.CreatedAt.String)
 
@@ -52,15 +108,27 @@ func FromModel(t database.Token) Token {
 		vu, _ = time.Parse(time.DateTime, t.ValidUntil.String)
 	}
 
+	lu := time.Time{}
+	if t.LastUsedAt.Valid {
+		lu, _ = time.Parse(time.DateTime, t.LastUsedAt.String)
+	}
+
 	return Token{
-		ID:         t.ID,
-		Token:      t.Token,
-		CreatedAt:  ca,
-		ValidUntil: vu,
+		ID:            t.ID,
+		UserId:        t.UserId,
+		CreatedAt:     ca,
+		ValidUntil:    vu,
+		Label:         t.Label.String,
+		Scopes:        splitScopes(t.Scopes),
+		LastUsedAt:    lu,
+		LastIP:        t.LastIP.String,
+		LastUserAgent: t.LastUserAgent.String,
+		IdleTimeout:   time.Duration(t.IdleTimeout) * time.Second,
+		Rotated:       t.RotatedAt.Valid,
 	}
 }
 
-// Generate a new token.
+// Generate a new token with all the scopes. Callers narrow the scopes down when the token should have less access.
 // A token is just 256-bit random number encoded as base64 string
 func New(validFor *time.Duration) *Token {
 	buf := make([]byte, 32)
@@ -82,5 +150,6 @@ func New(validFor *time.Duration) *Token {
 		Token:      t,
 		CreatedAt:  now,
 		ValidUntil: validUntil,
+		Scopes:     slices.Clone(AllScopes),
 	}
 }
@@ -1,6 +1,7 @@
 package token_test
 
 import (
+	"net/http/httptest"
 	"testing"
 	"time"
 
@@ -54,7 +55,9 @@ func TestDatabase(t *testing.T) {
 	db := sqlx.NewDb(godb, "sqlite")
 	repo := database.NewTokenRepository(db)
 
-	tok := token.New(nil).ToModel()
+	raw := token.New(nil)
+	raw.UserId = database.DefaultUserId
+	tok := raw.ToModel()
 	if err := repo.Insert(&tok); err != nil {
 		t.Fatal(err)
 	}
@@ -63,7 +66,11 @@ func TestDatabase(t *testing.T) {
 		t.Errorf("token id should be 1, got %v", tok.ID)
 	}
 
-	tok2, err := repo.Find(tok.Token)
+	if tok.TokenHash == raw.Token || tok.TokenHash != database.HashToken(raw.Token) {
+		t.Errorf("token should be stored as a digest, got %v", tok.TokenHash)
+	}
+
+	tok2, err := repo.Find(raw.Token)
 	if err != nil {
 		t.Fatal(err)
 	}
@@ -71,4 +78,133 @@ func TestDatabase(t *testing.T) {
 	if diff := cmp.Diff(tok, *tok2); diff != "" {
 		t.Errorf("two token instances should be equal (-want +got):\n%v", diff)
 	}
+
+	// The token itself isn't stored, so the digest of an empty token must not be made up for it
+	if tm := token.FromModel(*tok2).ToModel(); tm.TokenHash != "" {
+		t.Errorf("token from the database should have no digest, got %v", tm.TokenHash)
+	}
+}
+
+func TestParseScopes(t *testing.T) {
+	scopes, err := token.ParseScopes([]string{"write", "read", "write"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if diff := cmp.Diff([]token.Scope{token.ScopeWrite, token.ScopeRead}, scopes); diff != "" {
+		t.Errorf("unexpected scopes (-want +got):\n%v", diff)
+	}
+
+	if _, err := token.ParseScopes([]string{"read", "root"}); err == nil {
+		t.Error("expected an error for an unknown scope")
+	}
+}
+
+func TestReplacement(t *testing.T) {
+	week := 7 * 24 * time.Hour
+
+	expiring := token.New(&week)
+	expiring.UserId = 2
+	expiring.Label = "phone"
+	expiring.Scopes = []token.Scope{token.ScopeRead}
+	// Part of the lifetime has passed already
+	expiring.CreatedAt = expiring.CreatedAt.Add(-24 * time.Hour)
+	expiring.ValidUntil = expiring.ValidUntil.Add(-24 * time.Hour)
+
+	idle := token.New(nil)
+	idle.SetIdleTimeout(time.Hour)
+
+	tests := []struct {
+		name       string
+		old        *token.Token
+		validUntil time.Time
+	}{
+		{"keeps the expiry", expiring, expiring.ValidUntil},
+		{"starts a new idle window", idle, time.Now().UTC().Truncate(time.Second).Add(time.Hour)},
+		{"does not expire", token.New(nil), time.Time{}},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			n := test.old.Replacement()
+
+			if n.Token == test.old.Token {
+				t.Error("replacement should be a new token")
+			}
+			if n.UserId != test.old.UserId || n.Label != test.old.Label || !cmp.Equal(n.Scopes, test.old.Scopes) || n.IdleTimeout != test.old.IdleTimeout {
+				t.Errorf("replacement should inherit the old token: want %+v, got %+v", test.old, n)
+			}
+
+			if n.ValidUntil.Sub(test.validUntil).Abs() > time.Second {
+				t.Errorf("replacement should be valid until %v, got %v", test.validUntil, n.ValidUntil)
+			}
+		})
+	}
+}
+
+func TestUsageTracker(t *testing.T) {
+	godb, err := database.NewWithMigrations(":memory:", "../database/migrations")
+	if err != nil {
+		t.Fatal(err)
+	}
+	db := sqlx.NewDb(godb, "sqlite")
+	repo := database.NewTokenRepository(db)
+
+	// insert stores the token, and returns it as it would be read by middleware.Auth
+	insert := func(tok *token.Token) token.Token {
+		t.Helper()
+
+		tok.UserId = database.DefaultUserId
+		tm := tok.ToModel()
+		if err := repo.Insert(&tm); err != nil {
+			t.Fatal(err)
+		}
+		return token.FromModel(tm)
+	}
+
+	raw := token.New(nil)
+	fixed := insert(raw)
+	idle := token.New(nil)
+	idle.SetIdleTimeout(time.Hour)
+	// As if the token was created a while ago, and hasn't been used since
+	idle.CreatedAt = idle.CreatedAt.Add(-30 * time.Minute)
+	idle.ValidUntil = idle.ValidUntil.Add(-30 * time.Minute)
+	stored := insert(idle)
+
+	usage := token.NewUsageTracker(repo)
+	for _, ua := range []string{"first", "last"} {
+		r := httptest.NewRequest("GET", "/ping", nil)
+		r.RemoteAddr = "192.0.2.1:1234"
+		r.Header.Set("User-Agent", ua)
+		usage.Record(fixed, r)
+		usage.Record(stored, r)
+	}
+
+	// Nothing is written until the flush
+	if tm, err := repo.Find(raw.Token); err != nil || tm.LastUsedAt.Valid {
+		t.Errorf("usage was written before the flush: %+v %v", tm, err)
+	}
+
+	if err := usage.Flush(); err != nil {
+		t.Fatal(err)
+	}
+
+	tm, err := repo.Find(idle.Token)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got := token.FromModel(*tm)
+	if got.LastUsedAt.IsZero() || got.LastIP != "192.0.2.1" || got.LastUserAgent != "last" {
+		t.Errorf("last use was not recorded: %+v", got)
+	}
+	if want := got.LastUsedAt.Add(time.Hour); !got.ValidUntil.Equal(want) {
+		t.Errorf("expiry should be pushed forward to %v, got %v", want, got.ValidUntil)
+	}
+
+	tm, err = repo.Find(raw.Token)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if tm.ValidUntil.Valid {
+		t.Errorf("token without an idle timeout should keep its expiry, got %v", tm.ValidUntil.String)
+	}
 }
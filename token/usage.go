@@ -0,0 +1,92 @@
+package token
+
+import (
+	"log"
+	"net"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/3elDU/rss-reader-backend/database"
+)
+
+const (
+	// DefaultFlushInterval is how often the recorded uses of the tokens are written to the database
+	DefaultFlushInterval = 30 * time.Second
+	// MinIdleTimeout is the shortest allowed idle timeout. It's much longer than the flush interval,
+	// so that a token in use doesn't expire before its use is written.
+	MinIdleTimeout = 5 * time.Minute
+)
+
+// UsageTracker records when and by which client the tokens are used.
+// Only the last use of each token is kept in memory, and written to the database in batches, instead of on every request.
+type UsageTracker struct {
+	repo database.TokenRepository
+
+	mu      sync.Mutex
+	pending map[int64]database.TokenUsage
+}
+
+func NewUsageTracker(repo database.TokenRepository) *UsageTracker {
+	return &UsageTracker{
+		repo:    repo,
+		pending: map[int64]database.TokenUsage{},
+	}
+}
+
+// Record remembers the use of the token by the request, until the next Flush.
+func (u *UsageTracker) Record(t Token, r *http.Request) {
+	ip, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		ip = r.RemoteAddr
+	}
+
+	u.mu.Lock()
+	defer u.mu.Unlock()
+
+	u.pending[t.ID] = database.TokenUsage{
+		ID:        t.ID,
+		UsedAt:    time.Now().UTC().Format(time.DateTime),
+		IP:        ip,
+		UserAgent: r.UserAgent(),
+	}
+}
+
+// Flush writes the uses recorded since the last flush to the database.
+// If that fails, they are kept and written with the next flush, unless the token is used again in the meantime.
+func (u *UsageTracker) Flush() error {
+	u.mu.Lock()
+	batch := make([]database.TokenUsage, 0, len(u.pending))
+	for _, usage := range u.pending {
+		batch = append(batch, usage)
+	}
+	clear(u.pending)
+	u.mu.Unlock()
+
+	if len(batch) == 0 {
+		return nil
+	}
+
+	if err := u.repo.RecordUsage(batch); err != nil {
+		u.mu.Lock()
+		for _, usage := range batch {
+			if _, ok := u.pending[usage.ID]; !ok {
+				u.pending[usage.ID] = usage
+			}
+		}
+		u.mu.Unlock()
+		return err
+	}
+
+	return nil
+}
+
+// Run flushes the recorded uses with the given interval, forever.
+// Idle timeouts of the tokens should be much longer than the interval, since their expiry is only pushed forward on flush.
+func (u *UsageTracker) Run(interval time.Duration) {
+	for range time.Tick(interval) {
+		if err := u.Flush(); err != nil {
+			log.Printf("failed to record the token usage: %v", err)
+		}
+	}
+}